@@ -0,0 +1,295 @@
+package pgpkg
+
+// Adoption brings an existing database under the control of pgpkg. The objects described
+// by a package might already exist in the database, having been created by hand or by another
+// tool. Adopting the package records them as though pgpkg had created them, without running
+// anything, so that the first real deployment doesn't fail or leave duplicates behind.
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Adopt registers the root package of the project in an existing database, without running
+// any of its migrations or creating any of its managed objects. Migrations up to and including
+// the one named by through (or all migrations if through is empty) are marked as already applied,
+// and managed objects which already exist in the database are recorded as managed by the package.
+//
+// Migrations are run using the package role, which needs to own the objects they modify. If
+// transferOwnership is set, ownership of the package's schemas and the objects in them is
+// transferred to the package role; otherwise, objects owned by other roles are listed.
+//
+// The pgpkg schema itself is installed (or upgraded) as usual.
+func (p *Project) Adopt(dsn string, through string, transferOwnership bool) error {
+	if p.Root == nil {
+		return fmt.Errorf("no package to adopt")
+	}
+
+	if err := p.Parse(); err != nil {
+		return err
+	}
+
+	return p.updatePgpkg(dsn, func(tx *PkgTx) error {
+		if err := p.Root.adopt(tx, through, transferOwnership); err != nil {
+			return fmt.Errorf("unable to adopt package %s: %w", p.Root.Name, err)
+		}
+		return nil
+	})
+}
+
+func (p *Package) adopt(tx *PkgTx, through string, transferOwnership bool) error {
+	if _, err := tx.Exec("select pg_advisory_xact_lock(hashtext('pgpkg'))"); err != nil {
+		return fmt.Errorf("pgpkg: unable to obtain package lock: %w", err)
+	}
+
+	if err := p.createSchema(tx); err != nil {
+		return err
+	}
+
+	foreignObjects, err := p.foreignObjects(tx)
+	if err != nil {
+		return err
+	}
+
+	if transferOwnership {
+		if err = p.transferOwnership(tx, foreignObjects); err != nil {
+			return err
+		}
+	} else if len(foreignObjects) > 0 {
+		Stdout.Printf("%s: %d object(s) are not owned by role %s, and can't be changed by its migrations:\n",
+			p.Name, len(foreignObjects), p.RoleName)
+		for _, object := range foreignObjects {
+			Stdout.Printf("  %s %s (owner %s)\n", object.objectType, object.name, object.owner)
+		}
+		Stdout.Printf("%s: use --transfer-ownership to transfer them to role %s\n", p.Name, p.RoleName)
+	}
+
+	migrationCount, err := p.Schema.adoptMigrations(tx, through)
+	if err != nil {
+		return err
+	}
+
+	objectCount := 0
+	if p.MOB.HasUnits() {
+		if err = p.MOB.Parse(); err != nil {
+			return err
+		}
+
+		if objectCount, err = p.MOB.adopt(tx); err != nil {
+			return err
+		}
+	}
+
+	if err = p.register(tx); err != nil {
+		return err
+	}
+
+	Stdout.Printf("%s: adopted %d migration(s) and %d managed object(s)\n", p.Name, migrationCount, objectCount)
+	return nil
+}
+
+// An object in one of the package's schemas which isn't owned by the package role.
+type foreignObject struct {
+	objectType string // the type of object, as used in "alter ... owner to"
+	name       string // the qualified name of the object, quoted as needed
+	owner      string
+}
+
+// Queries that find the objects in a schema, along with their owners and the type used to transfer
+// them. Objects belonging to extensions, and objects whose ownership follows another object
+// (such as indexes and identity sequences), are not included.
+var ownershipQueries = []string{
+	`select 'schema', quote_ident(n.nspname), pg_get_userbyid(n.nspowner)
+	   from pg_namespace n
+	  where n.nspname = $1`,
+
+	`select case c.relkind when 'S' then 'sequence' when 'v' then 'view'
+	                       when 'm' then 'materialized view' when 'c' then 'type'
+	                       when 'f' then 'foreign table' else 'table' end,
+	        c.oid::regclass::text, pg_get_userbyid(c.relowner)
+	   from pg_class c join pg_namespace n on n.oid = c.relnamespace
+	  where n.nspname = $1 and c.relkind in ('r', 'p', 'f', 'v', 'm', 'S', 'c')
+	    and not exists (select 1 from pg_depend d
+	                     where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype in ('a', 'i', 'e'))`,
+
+	`select case p.prokind when 'p' then 'procedure' when 'a' then 'aggregate' else 'function' end,
+	        p.oid::regprocedure::text, pg_get_userbyid(p.proowner)
+	   from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+	  where n.nspname = $1
+	    and not exists (select 1 from pg_depend d
+	                     where d.classid = 'pg_proc'::regclass and d.objid = p.oid and d.deptype = 'e')`,
+
+	`select case t.typtype when 'd' then 'domain' else 'type' end, t.oid::regtype::text, pg_get_userbyid(t.typowner)
+	   from pg_type t join pg_namespace n on n.oid = t.typnamespace
+	  where n.nspname = $1 and t.typtype in ('e', 'd', 'r')
+	    and not exists (select 1 from pg_depend d
+	                     where d.classid = 'pg_type'::regclass and d.objid = t.oid and d.deptype = 'e')`,
+}
+
+// Find the package's schemas, and the objects in them, which aren't owned by the package role.
+func (p *Package) foreignObjects(tx *PkgTx) ([]foreignObject, error) {
+	var objects []foreignObject
+
+	for _, schemaName := range p.SchemaNames {
+		for _, query := range ownershipQueries {
+			rows, err := tx.Query(query, schemaName)
+			if err != nil {
+				return nil, fmt.Errorf("unable to find objects in schema %s: %w", schemaName, err)
+			}
+
+			for rows.Next() {
+				var object foreignObject
+				if err = rows.Scan(&object.objectType, &object.name, &object.owner); err != nil {
+					_ = rows.Close()
+					return nil, fmt.Errorf("unable to find objects in schema %s: %w", schemaName, err)
+				}
+
+				if object.owner != p.RoleName {
+					objects = append(objects, object)
+				}
+			}
+
+			if err = rows.Err(); err != nil {
+				return nil, fmt.Errorf("unable to find objects in schema %s: %w", schemaName, err)
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// Transfer ownership of the given objects to the package role, so that its migrations can modify them.
+func (p *Package) transferOwnership(tx *PkgTx, objects []foreignObject) error {
+	role := Sanitize(rolePattern, p.RoleName)
+
+	for _, object := range objects {
+		if _, err := tx.Exec(fmt.Sprintf(`alter %s %s owner to "%s"`, object.objectType, object.name, role)); err != nil {
+			return fmt.Errorf("unable to transfer ownership of %s %s: %w", object.objectType, object.name, err)
+		}
+
+		Stdout.Printf("%s: transferred ownership of %s %s from %s to %s\n", p.Name, object.objectType, object.name, object.owner, p.RoleName)
+	}
+
+	return nil
+}
+
+// Mark migrations as applied, without running them. Returns the number of migrations marked.
+func (s *Schema) adoptMigrations(tx *PkgTx, through string) (int, error) {
+	if through != "" && !s.hasMigrationName(through) {
+		return 0, fmt.Errorf("migration '%s' not found", through)
+	}
+
+	count := 0
+	for _, migrationPath := range s.migrationIndex {
+		migrationName := filepath.Base(migrationPath)
+
+		if _, err := tx.Exec("insert into pgpkg.migration (pkg, path) values ($1, $2) on conflict do nothing",
+			s.Package.Name, migrationName); err != nil {
+			return 0, fmt.Errorf("unable to save migration state: %w", err)
+		}
+		count++
+
+		if migrationName == through {
+			break
+		}
+	}
+
+	return count, nil
+}
+
+// hasMigrationName indicates if a migration with the given filename appears in the migration index.
+func (s *Schema) hasMigrationName(name string) bool {
+	for _, migrationPath := range s.migrationIndex {
+		if filepath.Base(migrationPath) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determine if the object created by a statement already exists in the database.
+// Comments are never adopted, since they don't need to be dropped.
+func (s *Statement) objectExists(tx *PkgTx) (bool, error) {
+	stmt := s.Tree.Stmt
+	var exists bool
+	var err error
+
+	switch {
+	case stmt.GetCreateFunctionStmt() != nil:
+		err = tx.QueryRow("select to_regprocedure($1) is not null", s.functionSignature()).Scan(&exists)
+
+	case stmt.GetViewStmt() != nil:
+		obj, _ := s.GetManagedObject()
+		err = tx.QueryRow("select to_regclass($1) is not null", obj.ObjectName).Scan(&exists)
+
+	case stmt.GetCreateTrigStmt() != nil:
+		trigStmt := stmt.GetCreateTrigStmt()
+		err = tx.QueryRow("select exists (select 1 from pg_trigger where tgname = $1 and tgrelid = to_regclass($2))",
+			trigStmt.Trigname, quote(trigStmt.Relation.Schemaname)+"."+quote(trigStmt.Relation.Relname)).Scan(&exists)
+
+	case stmt.GetCreateCastStmt() != nil:
+		castStmt := stmt.GetCreateCastStmt()
+		err = tx.QueryRow("select exists (select 1 from pg_cast where castsource = to_regtype($1) and casttarget = to_regtype($2))",
+			getTypeName(castStmt.Sourcetype), getTypeName(castStmt.Targettype)).Scan(&exists)
+	}
+
+	if err != nil {
+		return false, PKGErrorf(s, err, "unable to find existing object")
+	}
+
+	return exists, nil
+}
+
+// Record the managed objects which already exist in the database as belonging to this package,
+// replacing any existing state. Returns the number of objects recorded.
+func (m *MOB) adopt(tx *PkgTx) (int, error) {
+	_, err := tx.Exec("delete from pgpkg.managed_object where pkg=$1", m.Package.Name)
+	if err != nil {
+		return 0, fmt.Errorf("unable to remove existing state: %w", err)
+	}
+
+	var objects []*ManagedObject
+	for _, stmt := range m.state.pending {
+		exists, err := stmt.objectExists(tx)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			if m.Package.options().Verbose {
+				Verbose.Printf("%s: not adopted; object does not exist\n", stmt.Location())
+			}
+			continue
+		}
+
+		obj, err := stmt.GetManagedObject()
+		if err != nil {
+			return 0, err
+		}
+		objects = append(objects, obj)
+	}
+
+	// The definitions of the existing objects are recorded, so that they can be verified later.
+	defHashes, err := readDefinitionHashes(tx, objects)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, obj := range objects {
+		var defHash *string
+		if hash, ok := defHashes[obj]; ok {
+			defHash = &hash
+		}
+
+		// The source hash isn't recorded, since we don't know if the existing object matches the source.
+		if _, err = tx.Exec("insert into pgpkg.managed_object (pkg, seq, obj_type, obj_name, def_hash) values ($1, $2, $3, $4, $5)",
+			m.Package.Name, count, obj.ObjectType, obj.ObjectName, defHash); err != nil {
+			return 0, fmt.Errorf("unable to update package state: %w", err)
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -47,7 +47,7 @@ func (b *Bundle) getUnit(path string) (*Unit, bool) {
 // addUnit adds a new unit to the package. Note that it doesn't read or parse the unit
 // until requested.
 func (b *Bundle) addUnit(path string) error {
-	if Options.Verbose {
+	if b.Package.options().Verbose {
 		Verbose.Printf("%s: add unit: %s", b.Package.Name, path)
 	}
 
@@ -3,6 +3,7 @@ package pgpkg
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
@@ -101,6 +102,41 @@ func (c *WriteCache) importUnits(bundle *Bundle, cachePath string) error {
 	return nil
 }
 
+// Import files that aren't SQL, such as data files. These are copied as-is.
+func (c *WriteCache) importFiles(bundle *Bundle, cachePath string) error {
+	for _, unit := range bundle.Units {
+		unitpath := path.Join(cachePath, unit.Path)
+
+		if err := os.MkdirAll(path.Dir(unitpath), 0777); err != nil {
+			return err
+		}
+
+		r, err := bundle.Open(unit.Path)
+		if err != nil {
+			return fmt.Errorf("unable to open %s: %w", unit.Path, err)
+		}
+
+		uw, err := os.Create(unitpath)
+		if err != nil {
+			_ = r.Close()
+			return fmt.Errorf("unable to create file %s: %w", unitpath, err)
+		}
+
+		_, err = io.Copy(uw, r)
+		_ = r.Close()
+		if err != nil {
+			_ = uw.Close()
+			return fmt.Errorf("unable to write file %s: %w", unitpath, err)
+		}
+
+		if err := uw.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Import the migration file.
 func (c *WriteCache) importMigration(srcPkg *Package, targetPath string) error {
 	srcSchema := srcPkg.Schema
@@ -196,6 +232,10 @@ func (c *WriteCache) importPackage(pkg *Package) error {
 		return err
 	}
 
+	if err := c.importFiles(pkg.Data.Bundle, targetPath); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,186 @@
+package pgpkg
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// Catalog is a simplified snapshot of the structure of a set of schemas. It's used to
+// compare two databases that are expected to have the same structure; for example, a
+// database installed from a baseline, and one built by replaying every migration.
+//
+// Each object in the catalog is identified by a key such as "table gl.account" or
+// "column gl.account.id", and is described by a definition. Two catalogs are the same
+// if they contain the same keys with the same definitions.
+type Catalog struct {
+	Objects map[string]string
+}
+
+// CatalogDiff is a single difference between two catalogs. An empty definition means
+// that the object doesn't exist in that catalog.
+type CatalogDiff struct {
+	Key   string
+	Left  string
+	Right string
+}
+
+// Each of these queries returns a (key, definition) pair for the objects in the schemas
+// given by $1.
+var catalogQueries = []string{
+	// tables, views, sequences and composite types
+	`select case c.relkind
+	            when 'r' then 'table ' when 'p' then 'table ' when 'f' then 'foreign table '
+	            when 'v' then 'view ' when 'm' then 'materialized view '
+	            when 'S' then 'sequence ' else 'type '
+	        end || n.nspname || '.' || c.relname,
+	        case when c.relkind in ('v', 'm') then pg_get_viewdef(c.oid) else c.relkind::text end
+	   from pg_class c join pg_namespace n on n.oid = c.relnamespace
+	  where n.nspname = any($1) and c.relkind in ('r', 'p', 'f', 'v', 'm', 'S', 'c')`,
+
+	// columns, including types, nullability and defaults
+	`select 'column ' || n.nspname || '.' || c.relname || '.' || a.attname,
+	        format_type(a.atttypid, a.atttypmod)
+	          || case when a.attnotnull then ' not null' else '' end
+	          || case a.attidentity when 'a' then ' generated always as identity'
+	                                when 'd' then ' generated by default as identity' else '' end
+	          || coalesce(case when a.attgenerated = 's' then ' generated always as ' else ' default ' end
+	                        || pg_get_expr(d.adbin, d.adrelid), '')
+	   from pg_attribute a
+	   join pg_class c on c.oid = a.attrelid
+	   join pg_namespace n on n.oid = c.relnamespace
+	   left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+	  where n.nspname = any($1) and c.relkind in ('r', 'p', 'f', 'v', 'm', 'c')
+	    and a.attnum > 0 and not a.attisdropped`,
+
+	// enums, domains and ranges
+	`select 'type ' || n.nspname || '.' || t.typname,
+	        case t.typtype
+	            when 'e' then 'enum (' || coalesce((select string_agg(quote_literal(e.enumlabel), ', ' order by e.enumsortorder)
+	                                                  from pg_enum e where e.enumtypid = t.oid), '') || ')'
+	            when 'd' then 'domain ' || format_type(t.typbasetype, t.typtypmod)
+	                            || case when t.typnotnull then ' not null' else '' end
+	                            || coalesce(' default ' || t.typdefault, '')
+	            else 'range'
+	        end
+	   from pg_type t join pg_namespace n on n.oid = t.typnamespace
+	  where n.nspname = any($1) and t.typtype in ('e', 'd', 'r')`,
+
+	// table and domain constraints
+	`select 'constraint ' || n.nspname || '.' || coalesce(c.relname, t.typname) || '.' || con.conname,
+	        pg_get_constraintdef(con.oid)
+	   from pg_constraint con
+	   join pg_namespace n on n.oid = con.connamespace
+	   left join pg_class c on c.oid = con.conrelid
+	   left join pg_type t on t.oid = con.contypid
+	  where n.nspname = any($1)`,
+
+	// indexes
+	`select 'index ' || schemaname || '.' || indexname, indexdef
+	   from pg_indexes
+	  where schemaname = any($1)`,
+
+	// functions and procedures
+	`select case p.prokind when 'p' then 'procedure ' when 'a' then 'aggregate ' else 'function ' end
+	          || n.nspname || '.' || p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')',
+	        case when p.prokind in ('f', 'p') then pg_get_functiondef(p.oid) else p.prokind::text end
+	   from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+	  where n.nspname = any($1)`,
+
+	// triggers
+	`select 'trigger ' || n.nspname || '.' || c.relname || '.' || t.tgname, pg_get_triggerdef(t.oid)
+	   from pg_trigger t
+	   join pg_class c on c.oid = t.tgrelid
+	   join pg_namespace n on n.oid = c.relnamespace
+	  where n.nspname = any($1) and not t.tgisinternal`,
+}
+
+// ReadCatalog reads the structure of the given schemas from the database.
+func ReadCatalog(db *sql.DB, schemas []string) (*Catalog, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	// The catalog is read-only, so we never commit.
+	defer tx.Rollback()
+
+	// Definitions include qualified names based on the search path, so we make sure
+	// they are the same for every database.
+	if _, err = tx.Exec("set local search_path to pg_catalog"); err != nil {
+		return nil, fmt.Errorf("unable to set search path: %w", err)
+	}
+
+	catalog := &Catalog{Objects: make(map[string]string)}
+
+	for _, query := range catalogQueries {
+		rows, err := tx.Query(query, pq.Array(schemas))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read catalog: %w", err)
+		}
+
+		for rows.Next() {
+			var key, definition string
+			if err = rows.Scan(&key, &definition); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("unable to read catalog: %w", err)
+			}
+			catalog.Objects[key] = definition
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read catalog: %w", err)
+		}
+	}
+
+	return catalog, nil
+}
+
+// Diff compares two catalogs, and returns the differences between them in key order.
+func (c *Catalog) Diff(other *Catalog) []CatalogDiff {
+	var diffs []CatalogDiff
+
+	for key, left := range c.Objects {
+		right, ok := other.Objects[key]
+		if !ok || left != right {
+			diffs = append(diffs, CatalogDiff{Key: key, Left: left, Right: right})
+		}
+	}
+
+	for key, right := range other.Objects {
+		if _, ok := c.Objects[key]; !ok {
+			diffs = append(diffs, CatalogDiff{Key: key, Right: right})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Key < diffs[j].Key
+	})
+
+	return diffs
+}
+
+// CompareCatalogs reads the catalogs of the given schemas from two databases, and
+// returns the differences between them.
+func CompareCatalogs(leftDSN string, rightDSN string, schemas []string) ([]CatalogDiff, error) {
+	var catalogs []*Catalog
+
+	for _, dsn := range []string{leftDSN, rightDSN} {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open database: %w", err)
+		}
+
+		catalog, err := ReadCatalog(db, schemas)
+		_ = db.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		catalogs = append(catalogs, catalog)
+	}
+
+	return catalogs[0].Diff(catalogs[1]), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Adopt an existing database into a package, without running any migrations or
+// creating any objects.
+func doAdopt(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("adopt", flag.ExitOnError)
+	throughFlag := flagSet.String("through", "", "mark migrations as applied up to and including this one (default: all)")
+	transferFlag := flagSet.Bool("transfer-ownership", false, "transfer ownership of the package's schemas and the objects in them to the package role")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	pkgPath, err := findPkg(flagSet.Args())
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	p, err := pgpkg.NewProjectFrom(pkgPath)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	pgpkg.Exit(p.Adopt(dsn, *throughFlag, *transferFlag))
+}
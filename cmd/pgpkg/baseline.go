@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+	"strings"
+)
+
+// Print a catalog difference. Long definitions (like functions) are summarised.
+func printCatalogDiff(diff pgpkg.CatalogDiff, leftName string, rightName string) {
+	switch {
+	case diff.Left == "":
+		fmt.Printf("%s: only in %s\n", diff.Key, rightName)
+	case diff.Right == "":
+		fmt.Printf("%s: only in %s\n", diff.Key, leftName)
+	case strings.ContainsRune(diff.Left, '\n') || strings.ContainsRune(diff.Right, '\n'):
+		fmt.Printf("%s: definitions differ\n", diff.Key)
+	default:
+		fmt.Printf("%s: differs\n    %-10s %s\n    %-10s %s\n", diff.Key, leftName+":", diff.Left, rightName+":", diff.Right)
+	}
+}
+
+// Install the package twice - once using the baseline, and once by replaying every migration -
+// and check that the resulting catalogs are the same.
+func doCheckBaseline(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	// This is here just so we can easily add new flags later if needed.
+	flagSet := flag.NewFlagSet("check-baseline", flag.ExitOnError)
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	pgpkg.Options.IgnoreBaseline = false
+	baselineDB, err := initTempDb(dsn, flagSet)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if baselineDB.Project.Root.Baseline() == "" {
+		pgpkg.DropTempDBOrExit(dsn, baselineDB.DBName)
+		pgpkg.Exit(fmt.Errorf("package %s does not have a Baseline", baselineDB.Project.Root.Name))
+	}
+
+	pgpkg.Options.IgnoreBaseline = true
+	replayDB, err := initTempDb(dsn, flagSet)
+	if err != nil {
+		pgpkg.DropTempDBOrExit(dsn, baselineDB.DBName)
+		pgpkg.Exit(err)
+	}
+
+	diffs, err := pgpkg.CompareCatalogs(baselineDB.DSN, replayDB.DSN, baselineDB.Project.SchemaNames())
+
+	pgpkg.DropTempDBOrExit(dsn, baselineDB.DBName)
+	pgpkg.DropTempDBOrExit(dsn, replayDB.DBName)
+
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	for _, diff := range diffs {
+		printCatalogDiff(diff, "baseline", "migrations")
+	}
+
+	if len(diffs) > 0 {
+		pgpkg.Exit(fmt.Errorf("baseline %s differs from migrations in %d object(s)",
+			baselineDB.Project.Root.Baseline(), len(diffs)))
+	}
+
+	fmt.Println("baseline matches migrations")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+const cacheUsage = "usage: pgpkg cache clean-db"
+
+// Commands that manage pgpkg's caches.
+func doCache(dsn string) {
+	if len(os.Args) < 3 {
+		pgpkg.Exit(fmt.Errorf(cacheUsage))
+	}
+
+	switch os.Args[2] {
+	case "clean-db":
+		doCacheCleanDB(dsn)
+
+	default:
+		pgpkg.Exit(fmt.Errorf(cacheUsage))
+	}
+}
+
+// Drop the template databases used to create temporary databases for pgpkg test and pgpkg repl.
+func doCacheCleanDB(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	dropped, err := pgpkg.DropTemplateDBs(dsn)
+	for _, dbname := range dropped {
+		fmt.Println("dropped", dbname)
+	}
+
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Drop temporary databases left behind by pgpkg test --keep-db-on-failure, or by pgpkg
+// commands that didn't exit cleanly.
+func doCleanup(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	forceFlag := flagSet.Bool("force", false, "also drop databases which are in use, disconnecting their sessions")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	dropped, inUse, err := pgpkg.DropAllTempDBs(dsn, *forceFlag)
+	for _, dbname := range dropped {
+		fmt.Println("dropped", dbname)
+	}
+
+	for _, dbname := range inUse {
+		fmt.Printf("skipped %s, which is in use; use --force to drop it\n", dbname)
+	}
+
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Extract a package from a schema in an existing database.
+func doExtract(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("extract", flag.ExitOnError)
+	schemaFlag := flagSet.String("schema", "", "name of the schema to extract (required)")
+	packageFlag := flagSet.String("package", "", "name of the package to create (default: the schema name)")
+	adoptFlag := flagSet.Bool("adopt", false, "adopt the extracted package in the source database")
+	transferFlag := flagSet.Bool("transfer-ownership", false, "with --adopt, transfer ownership of the schema and the objects in it to the package role")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	if *schemaFlag == "" {
+		pgpkg.Exit(fmt.Errorf("usage: pgpkg extract --schema <schema> [--package <name>] <dir>"))
+	}
+
+	if flagSet.NArg() != 1 {
+		pgpkg.Exit(fmt.Errorf("usage: pgpkg extract --schema <schema> [--package <name>] <dir>"))
+	}
+
+	dir := flagSet.Arg(0)
+	if err := pgpkg.Extract(dsn, *schemaFlag, *packageFlag, dir); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if !*adoptFlag {
+		fmt.Printf("to deploy the package to the source database, first run: pgpkg adopt %s\n", dir)
+		return
+	}
+
+	// Only change the source database when asked to.
+	p, err := pgpkg.NewProjectFrom(dir)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	pgpkg.Exit(p.Adopt(dsn, "", *transferFlag))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Import the migration history of another migration tool into pgpkg.
+func doImportHistory(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("import-history", flag.ExitOnError)
+	fromFlag := flagSet.String("from", "", "migration tool to import from: flyway, golang-migrate or sqitch (required)")
+	tableFlag := flagSet.String("table", "", "name of the tool's history table, if it's not the default")
+	projectFlag := flagSet.String("project", "", "sqitch project to import (default: the only project in the history table)")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	if *fromFlag == "" {
+		pgpkg.Exit(fmt.Errorf("usage: pgpkg import-history --from {flyway | golang-migrate | sqitch} [--table <table>] [--project <project>] [package]"))
+	}
+
+	pkgPath, err := findPkg(flagSet.Args())
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	p, err := pgpkg.NewProjectFrom(pkgPath)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	pgpkg.Exit(p.ImportHistory(dsn, *fromFlag, *tableFlag, *projectFlag))
+}
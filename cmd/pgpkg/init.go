@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Create a new package.
+func doInit() {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("init", flag.ExitOnError)
+	nameFlag := flagSet.String("name", "", "name of the package (default: the directory name)")
+	schemaFlag := flagSet.String("schema", "", "name of the package's schema (default: derived from the package name)")
+	goFlag := flagSet.Bool("go", false, "also create a main.go which embeds and deploys the package")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	if flagSet.NArg() > 1 {
+		pgpkg.Exit(fmt.Errorf("usage: pgpkg init [--name <name>] [--schema <schema>] [--go] [dir]"))
+	}
+
+	dir := "."
+	if flagSet.NArg() == 1 {
+		dir = flagSet.Arg(0)
+	}
+
+	if err := pgpkg.InitPackage(dir, *nameFlag, *schemaFlag, *goFlag); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	fmt.Println("created package in", dir)
+}
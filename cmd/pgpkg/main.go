@@ -35,6 +35,42 @@ func main() {
 	case "info":
 		doInfo()
 
+	case "check-baseline":
+		doCheckBaseline(dsn)
+
+	case "check-upgrade":
+		doCheckUpgrade(dsn)
+
+	case "adopt":
+		doAdopt(dsn)
+
+	case "extract":
+		doExtract(dsn)
+
+	case "import-history":
+		doImportHistory(dsn)
+
+	case "init":
+		doInit()
+
+	case "new":
+		doNew()
+
+	case "migration":
+		doMigration(dsn)
+
+	case "plan":
+		doPlan(dsn)
+
+	case "verify":
+		doVerify(dsn)
+
+	case "cache":
+		doCache(dsn)
+
+	case "cleanup":
+		doCleanup(dsn)
+
 	default:
 		usage()
 		os.Exit(1)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+const migrationUsage = "usage: pgpkg migration generate <name> [package]"
+
+// Commands that work with migration scripts.
+func doMigration(dsn string) {
+	if len(os.Args) < 3 {
+		pgpkg.Exit(fmt.Errorf(migrationUsage))
+	}
+
+	switch os.Args[2] {
+	case "generate":
+		doMigrationGenerate(dsn)
+
+	default:
+		pgpkg.Exit(fmt.Errorf(migrationUsage))
+	}
+}
+
+// Generate a migration from the declarative table definitions in a package.
+func doMigrationGenerate(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if len(os.Args) < 4 {
+		pgpkg.Exit(fmt.Errorf(migrationUsage))
+	}
+	name := os.Args[3]
+
+	// This is here just so we can easily add new flags later if needed.
+	flagSet := flag.NewFlagSet("migration generate", flag.ExitOnError)
+	if err := flagSet.Parse(os.Args[4:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	// The tests don't need to pass to generate a migration.
+	pgpkg.Options.SkipTests = true
+	tempDB, err := initTempDb(dsn, flagSet)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	script, err := tempDB.Project.Root.GenerateMigration(tempDB.DSN)
+	pgpkg.DropTempDBOrExit(dsn, tempDB.DBName)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if script == "" {
+		fmt.Println("tables match their definitions; no migration needed")
+		return
+	}
+
+	migrationPath, err := tempDB.Project.Root.CreateMigration(name, script)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	fmt.Println("created migration", migrationPath)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+	"strings"
+)
+
+const newUsage = "usage: pgpkg new migration {<description> | --convert} [package]"
+
+// Commands that create new things in a package.
+func doNew() {
+	if len(os.Args) < 3 {
+		pgpkg.Exit(fmt.Errorf(newUsage))
+	}
+
+	switch os.Args[2] {
+	case "migration":
+		doNewMigration()
+
+	default:
+		pgpkg.Exit(fmt.Errorf(newUsage))
+	}
+}
+
+// Create a new migration script, and add it to the package's Migrations list.
+func doNewMigration() {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("new migration", flag.ExitOnError)
+	convertFlag := flagSet.Bool("convert", false, "convert a legacy @migration.pgpkg file to the Migrations clause")
+	if err := flagSet.Parse(os.Args[3:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	args := flagSet.Args()
+	var description string
+	if !*convertFlag {
+		if len(args) == 0 {
+			pgpkg.Exit(fmt.Errorf(newUsage))
+		}
+		description, args = args[0], args[1:]
+	}
+
+	pkgPath, err := findPkg(args)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if strings.HasSuffix(pkgPath, ".zip") {
+		pgpkg.Exit(fmt.Errorf("can't add migrations to a ZIP file"))
+	}
+
+	p, err := pgpkg.NewProjectFrom(pkgPath)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if *convertFlag {
+		count, err := p.Root.ConvertMigrationCatalog()
+		if err != nil {
+			pgpkg.Exit(err)
+		}
+		fmt.Printf("converted %d migration(s) to the Migrations clause\n", count)
+		return
+	}
+
+	migrationPath, err := p.Root.NewMigration(description)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	fmt.Println("created migration", migrationPath)
+}
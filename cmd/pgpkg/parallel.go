@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var errInterrupted = errors.New("tests were interrupted")
+
+// Run the tests of a project in parallel. The project has already been deployed into tempDB
+// (without running its tests), which is used as a template to create a clone for each worker.
+// Each worker runs a share of the tests in its own clone. The clones are dropped when the tests
+// are complete, or if the run is interrupted.
+func runParallelTests(dsn string, tempDB *TempDB, workers int) error {
+	var clones []string
+	var clonesLock sync.Mutex
+	var cleanupOnce sync.Once
+	var cleanupErr error
+	var keepTempDB bool
+
+	cleanup := func() {
+		cleanupOnce.Do(func() {
+			clonesLock.Lock()
+			defer clonesLock.Unlock()
+
+			dbnames := clones
+			if !keepTempDB {
+				dbnames = append(dbnames, tempDB.DBName)
+			}
+			cleanupErr = pgpkg.DropTempDBs(dsn, dbnames)
+		})
+	}
+
+	// If the run is interrupted, the workers are cancelled, and the test databases are dropped once
+	// the workers have finished with them.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-interrupt:
+			fmt.Fprintln(os.Stderr, "pgpkg: interrupted; dropping test databases")
+			cancel()
+
+			// A second interrupt stops pgpkg straight away.
+			signal.Stop(interrupt)
+		case <-done:
+		}
+	}()
+
+	// Create the clones, and a separate project for each worker, so that workers don't share any state.
+	projects := make([]*pgpkg.Project, workers)
+	for i := range projects {
+		if ctx.Err() != nil {
+			cleanup()
+			return errors.Join(errInterrupted, cleanupErr)
+		}
+
+		clone, err := pgpkg.CreateTempDBFrom(dsn, tempDB.DBName)
+		if err != nil {
+			cleanup()
+			return errors.Join(err, cleanupErr)
+		}
+
+		clonesLock.Lock()
+		clones = append(clones, clone)
+		clonesLock.Unlock()
+
+		if projects[i], err = pgpkg.NewProjectFrom(tempDB.PkgPath); err != nil {
+			cleanup()
+			return errors.Join(err, cleanupErr)
+		}
+		projects[i].Options = pgpkg.Options.Copy()
+	}
+
+	workerErrs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i, p := range projects {
+		wg.Add(1)
+		go func(i int, p *pgpkg.Project) {
+			defer wg.Done()
+			workerErrs[i] = p.RunTestsContext(ctx, dsn+" dbname="+clones[i], i, workers)
+		}(i, p)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		cleanup()
+		return errors.Join(errInterrupted, cleanupErr)
+	}
+
+	var results []*pgpkg.TestResult
+	for _, p := range projects {
+		results = append(results, p.TestResults...)
+	}
+
+	err := mergeTestErrors(workerErrs)
+	if reportErr := pgpkg.WriteTestReports(pgpkg.Options.Copy(), results); reportErr != nil {
+		err = errors.Join(err, reportErr)
+	}
+
+	// With --keep-db-on-failure, the first failed test is recreated in the original test database,
+	// which isn't needed as a template any more. The clones are dropped.
+	if err != nil {
+		for _, p := range projects {
+			kept, keepErr := keepTempDb(dsn, p, tempDB.DBName)
+			if keepErr != nil {
+				err = errors.Join(err, keepErr)
+			}
+
+			if kept || keepErr != nil {
+				clonesLock.Lock()
+				keepTempDB = kept
+				clonesLock.Unlock()
+				break
+			}
+		}
+	}
+
+	cleanup()
+	return errors.Join(err, cleanupErr)
+}
+
+// Merge the errors from each worker, so that every test failure is reported. Test failures are
+// returned as a single PKGError, with the other failures attached; other errors are joined.
+func mergeTestErrors(workerErrs []error) error {
+	var failures []*pgpkg.PKGError
+	var otherErrs []error
+
+	for _, err := range workerErrs {
+		if err == nil {
+			continue
+		}
+
+		var pkgErr *pgpkg.PKGError
+		if !errors.As(err, &pkgErr) {
+			otherErrs = append(otherErrs, err)
+			continue
+		}
+
+		failures = append(failures, pkgErr)
+		failures = append(failures, pkgErr.Errors...)
+	}
+
+	if len(failures) > 0 {
+		failures[0].Errors = failures[1:]
+		otherErrs = append([]error{fmt.Errorf("tests failed: %w", failures[0])}, otherErrs...)
+	}
+
+	return errors.Join(otherErrs...)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Show what a deployment would do, without changing the database.
+func doPlan(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("plan", flag.ExitOnError)
+	jsonFlag := flagSet.Bool("json", false, "print the plan as JSON")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	pkgPath, err := findPkg(flagSet.Args())
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	p, err := pgpkg.NewProjectFrom(pkgPath)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	plan, err := p.Plan(dsn)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if *jsonFlag {
+		pgpkg.Exit(plan.WriteJSON(os.Stdout))
+	}
+
+	plan.Print(os.Stdout)
+}
@@ -81,7 +81,12 @@ func doRepl(dsn string) {
 		pgpkg.Exit(err)
 	}
 
-	defer pgpkg.DropTempDBOrExit(dsn, tempDB.DBName)
+	// psql might not have quite finished with the database when the REPL exits.
+	defer func() {
+		if err := pgpkg.ForceDropTempDB(dsn, tempDB.DBName); err != nil {
+			pgpkg.Exit(fmt.Errorf("unable to drop REPL database %s: %w", tempDB.DBName, err))
+		}
+	}()
 
 	if *watchFlag {
 		if err = startReplWatch(tempDB); err != nil {
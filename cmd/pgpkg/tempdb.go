@@ -1,10 +1,14 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/pgpkg/pgpkg"
+	"os"
+	"strings"
 )
 
 type TempDB struct {
@@ -14,10 +18,27 @@ type TempDB struct {
 	Project *pgpkg.Project
 }
 
+// Upgrade describes a previous release of a package which is installed into a temp DB
+// before the current source, so that the upgrade path can be tested.
+type Upgrade struct {
+	FromPath string // path to an exported (ZIP) release of the package
+	SeedPath string // optional SQL script, run after the previous release is installed
+}
+
 // Set up a project in a temp DB, and return the database's name.
 // Before exiting, the database should be removed by the caller with dropTempDBOrExit().
 // This is used by "pgpkg repl" and "pgpgk test".
 func initTempDb(dsn string, flagSet *flag.FlagSet) (*TempDB, error) {
+	return initTempDbFrom(dsn, flagSet, nil, pgpkg.Options.Copy())
+}
+
+// Set up a project in a temp DB, as with initTempDb, using the given options for the project.
+// If upgrade is not nil, the previous release is installed (and optionally seeded) first, and
+// the project is deployed on top of it.
+//
+// Unless --no-cache-db is set, the temp DB is created as a copy of a template database which is
+// only rebuilt when the project changes, and the tests are run in the copy.
+func initTempDbFrom(dsn string, flagSet *flag.FlagSet, upgrade *Upgrade, options *pgpkg.OptionSet) (*TempDB, error) {
 	pkgPath, err := findPkg(flagSet.Args())
 	if err != nil {
 		return nil, err
@@ -28,29 +49,219 @@ func initTempDb(dsn string, flagSet *flag.FlagSet) (*TempDB, error) {
 		return nil, err
 	}
 
+	p.Options = options
+	p.Options.DryRun = false
+
+	// Test scripts aren't kept when tests are run in a copy of the template.
+	var tempDbName string
+	if p.Options.NoCacheDB || p.Options.KeepTestScripts {
+		tempDbName, err = buildTempDb(dsn, p, upgrade)
+	} else {
+		tempDbName, err = copyTemplateDb(dsn, p, pkgPath, upgrade)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TempDB{
+		DSN:     tempDSN(dsn, tempDbName),
+		DBName:  tempDbName,
+		PkgPath: pkgPath,
+		Project: p,
+	}, nil
+}
+
+// Add the temp dbname to the DSN, which will override the PGDATABASE environment variable.
+// If there are two dbnames, only the last one is used, effectively overriding
+// anything in the environment.
+func tempDSN(dsn string, tempDbName string) string {
+	return dsn + " dbname=" + tempDbName
+}
+
+// Create a temp DB and deploy the project into it from scratch.
+func buildTempDb(dsn string, p *pgpkg.Project, upgrade *Upgrade) (string, error) {
 	tempDbName, err := pgpkg.CreateTempDB(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("pgpkg: unable to create REPL database: %w\n", err)
+		return "", fmt.Errorf("pgpkg: unable to create REPL database: %w\n", err)
 	}
 
-	// Add the REPL dbname to the DSN, which will override the PGDATABASE environment variable.
-	// If there are two dbnames, only the last one is used, effectively overriding
-	// anything in the environment.
-	tempDSN := dsn + " dbname=" + tempDbName
+	// With --keep-db-on-failure, the tests are run after the project has been deployed,
+	// so that the project is still there if they fail. The project is deployed with its own
+	// copy of the options, so that it can skip the tests.
+	options := p.Options
+	testAfterDeploy := options.KeepDBOnFailure && !options.SkipTests
 
-	pgpkg.Options.DryRun = false
+	p.Options = options.Copy()
+	p.Options.SkipTests = options.SkipTests || testAfterDeploy
+	err = deployTempDb(tempDSN(dsn, tempDbName), p, upgrade)
+	p.Options = options
 
-	err = p.Migrate(tempDSN)
 	if err != nil {
 		// Clean up the database if there's an error; the caller will probably forget to do so.
 		dropErr := pgpkg.DropTempDB(dsn, tempDbName)
-		return nil, errors.Join(err, dropErr)
+		return "", errors.Join(err, dropErr)
 	}
 
-	return &TempDB{
-		DSN:     tempDSN,
-		DBName:  tempDbName,
-		PkgPath: pkgPath,
-		Project: p,
-	}, nil
+	if testAfterDeploy {
+		if err = testTempDb(dsn, p, tempDbName); err != nil {
+			return "", err
+		}
+	}
+
+	return tempDbName, nil
+}
+
+// Deploy the project into an empty database, installing the previous release first
+// if we're testing an upgrade.
+func deployTempDb(tempDSN string, p *pgpkg.Project, upgrade *Upgrade) error {
+	if upgrade != nil {
+		if err := installPrevious(tempDSN, upgrade, p.Options); err != nil {
+			return err
+		}
+	}
+
+	return p.Migrate(tempDSN)
+}
+
+// Create a temp DB as a copy of the project's template database, building the template
+// first if needed, and then run the tests in the copy.
+func copyTemplateDb(dsn string, p *pgpkg.Project, pkgPath string, upgrade *Upgrade) (string, error) {
+	key, err := templateKey(p, upgrade)
+	if err != nil {
+		return "", err
+	}
+
+	// Templates for upgrades are kept separately from the project's own template.
+	label := p.Root.Name
+	if upgrade != nil {
+		label = label + " upgraded from " + upgrade.FromPath
+	}
+
+	// The template is built from a separate project, without running the tests; they are run later.
+	template, err := p.TemplateDB(dsn, label, key, func(buildDSN string) error {
+		buildProject, err := pgpkg.NewProjectFrom(pkgPath)
+		if err != nil {
+			return err
+		}
+
+		buildProject.Options = p.Options.Copy()
+		buildProject.Options.SkipTests = true
+		return deployTempDb(buildDSN, buildProject, upgrade)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	// If the template can't be copied, for example because it's still in use by another pgpkg
+	// process, the database is built from scratch instead.
+	tempDbName, err := pgpkg.CreateTempDBFrom(dsn, template)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pgpkg: unable to copy template database; building from scratch: %v\n", err)
+		return buildTempDb(dsn, p, upgrade)
+	}
+
+	if !p.Options.SkipTests {
+		if err = testTempDb(dsn, p, tempDbName); err != nil {
+			return "", err
+		}
+	}
+
+	return tempDbName, nil
+}
+
+// Run the tests in a temp DB which already contains the project. If the tests fail, the
+// temp DB is dropped, unless it's kept for --keep-db-on-failure.
+func testTempDb(dsn string, p *pgpkg.Project, tempDbName string) error {
+	err := p.RunTests(tempDSN(dsn, tempDbName), 0, 1)
+	if reportErr := pgpkg.WriteTestReports(p.Options, p.TestResults); reportErr != nil {
+		err = errors.Join(err, reportErr)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	kept, keepErr := keepTempDb(dsn, p, tempDbName)
+	if kept {
+		return err
+	}
+
+	dropErr := pgpkg.DropTempDB(dsn, tempDbName)
+	return errors.Join(err, keepErr, dropErr)
+}
+
+// If --keep-db-on-failure is set, recreate the state of the project's first failed test in
+// the temp DB, and tell the user where to find it. Returns true if the temp DB should be kept.
+func keepTempDb(dsn string, p *pgpkg.Project, tempDbName string) (bool, error) {
+	if !p.Options.KeepDBOnFailure {
+		return false, nil
+	}
+
+	failed, err := p.KeepFailedTest(tempDSN(dsn, tempDbName))
+	if err != nil || failed == nil {
+		return false, err
+	}
+
+	fmt.Fprintf(os.Stderr, "pgpkg: test %s failed; keeping test database %s\n", failed.Name, tempDbName)
+	fmt.Fprintf(os.Stderr, "pgpkg: connect with: psql \"%s\"\n", strings.TrimSpace(tempDSN(dsn, tempDbName)))
+	fmt.Fprintln(os.Stderr, "pgpkg: run \"pgpkg cleanup\" to drop the database when you're done")
+	return true, nil
+}
+
+// Work out the key of the template database for a project. The key includes the previous
+// release and seed script when testing an upgrade.
+func templateKey(p *pgpkg.Project, upgrade *Upgrade) (string, error) {
+	sourceHash, err := p.SourceHash()
+	if err != nil {
+		return "", err
+	}
+
+	if upgrade == nil {
+		return sourceHash, nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte(sourceHash))
+	for _, upgradePath := range []string{upgrade.FromPath, upgrade.SeedPath} {
+		if upgradePath == "" {
+			continue
+		}
+
+		contents, err := os.ReadFile(upgradePath)
+		if err != nil {
+			return "", fmt.Errorf("unable to read %s: %w", upgradePath, err)
+		}
+		h.Write(contents)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Install a previous release into a temp DB, and load the seed data, if any, using a copy of
+// the given options. The tests of the previous release are not run.
+func installPrevious(tempDSN string, upgrade *Upgrade, options *pgpkg.OptionSet) error {
+	if !strings.HasSuffix(upgrade.FromPath, ".zip") {
+		return fmt.Errorf("previous release must be an exported ZIP file: %s", upgrade.FromPath)
+	}
+
+	// NewProjectFrom reads ZIP files using NewZipPathSource.
+	prev, err := pgpkg.NewProjectFrom(upgrade.FromPath)
+	if err != nil {
+		return fmt.Errorf("unable to read previous release: %w", err)
+	}
+
+	prev.Options = options.Copy()
+	prev.Options.SkipTests = true
+
+	if err = prev.Migrate(tempDSN); err != nil {
+		return fmt.Errorf("unable to install previous release %s: %w", upgrade.FromPath, err)
+	}
+
+	if upgrade.SeedPath != "" {
+		return pgpkg.SeedTempDB(tempDSN, upgrade.SeedPath)
+	}
+
+	return nil
 }
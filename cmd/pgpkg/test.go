@@ -15,18 +15,56 @@ func doTest(dsn string) {
 	// This is set by default with pgpkg test.
 	pgpkg.Options.ShowTests = true
 
-	// This is here just so we can easily add new flags later if needed.
 	flagSet := flag.NewFlagSet("test", flag.ExitOnError)
+	fromFlag := flagSet.String("from", "", "install this exported release first, and test the upgrade from it")
+	seedFlag := flagSet.String("seed", "", "SQL script to run after installing the --from release")
+	parallelFlag := flagSet.Int("parallel", 1, "run the tests in parallel, in this many copies of the test database")
 	if err := flagSet.Parse(os.Args[2:]); err != nil {
 		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
 	}
 
+	// Test scripts are kept by the migration, which is rolled back if a test fails.
+	if pgpkg.Options.KeepDBOnFailure && pgpkg.Options.KeepTestScripts {
+		pgpkg.Exit(fmt.Errorf("--keep-db-on-failure can't be used with --keep-test-scripts"))
+	}
+
+	var upgrade *Upgrade
+	if *fromFlag != "" {
+		upgrade = &Upgrade{FromPath: *fromFlag, SeedPath: *seedFlag}
+	} else if *seedFlag != "" {
+		pgpkg.Exit(fmt.Errorf("--seed can only be used with --from"))
+	}
+
+	if *parallelFlag > 1 {
+		doParallelTest(dsn, flagSet, upgrade, *parallelFlag)
+		return
+	}
+
 	// The purpose of "pgpkg test" is just to build the schema in a test database
 	// and return, reporting any errors along the way. So that's what we do!
-	tempDB, err := initTempDb(dsn, flagSet)
+	tempDB, err := initTempDbFrom(dsn, flagSet, upgrade, pgpkg.Options.Copy())
 	if err != nil {
 		pgpkg.Exit(err)
 	}
 
 	pgpkg.DropTempDBOrExit(dsn, tempDB.DBName)
 }
+
+// Build the schema in a test database without running the tests, and then run the tests
+// in parallel in copies of that database.
+func doParallelTest(dsn string, flagSet *flag.FlagSet, upgrade *Upgrade, workers int) {
+	if pgpkg.Options.SkipTests {
+		pgpkg.Exit(fmt.Errorf("--parallel can't be used with --skip-tests"))
+	}
+
+	options := pgpkg.Options.Copy()
+	options.SkipTests = true
+	tempDB, err := initTempDbFrom(dsn, flagSet, upgrade, options)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if err = runParallelTests(dsn, tempDB, workers); err != nil {
+		pgpkg.Exit(err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Install the package twice - once by upgrading from a previous release, and once from scratch -
+// and check that the resulting catalogs are the same.
+func doCheckUpgrade(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("check-upgrade", flag.ExitOnError)
+	fromFlag := flagSet.String("from", "", "exported release to upgrade from (required)")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	if *fromFlag == "" {
+		pgpkg.Exit(fmt.Errorf("usage: pgpkg check-upgrade --from <release.zip> [package]"))
+	}
+
+	upgradeDB, err := initTempDbFrom(dsn, flagSet, &Upgrade{FromPath: *fromFlag}, pgpkg.Options.Copy())
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	freshDB, err := initTempDb(dsn, flagSet)
+	if err != nil {
+		pgpkg.DropTempDBOrExit(dsn, upgradeDB.DBName)
+		pgpkg.Exit(err)
+	}
+
+	diffCount := 0
+	for _, schemaName := range freshDB.Project.SchemaNames() {
+		var diffs []pgpkg.CatalogDiff
+		diffs, err = pgpkg.CompareCatalogs(upgradeDB.DSN, freshDB.DSN, []string{schemaName})
+		if err != nil {
+			break
+		}
+
+		if len(diffs) > 0 {
+			fmt.Printf("schema %s:\n", schemaName)
+		}
+
+		for _, diff := range diffs {
+			printCatalogDiff(diff, "upgrade", "fresh")
+		}
+		diffCount += len(diffs)
+	}
+
+	pgpkg.DropTempDBOrExit(dsn, upgradeDB.DBName)
+	pgpkg.DropTempDBOrExit(dsn, freshDB.DBName)
+
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if diffCount > 0 {
+		pgpkg.Exit(fmt.Errorf("upgrade from %s differs from a fresh install in %d object(s)", *fromFlag, diffCount))
+	}
+
+	fmt.Println("upgrade matches fresh install")
+}
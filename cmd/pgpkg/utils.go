@@ -9,7 +9,7 @@ import (
 )
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: pgpkg {deploy | repl | try | export | import} [options]")
+	fmt.Fprintln(os.Stderr, "usage: pgpkg {init | deploy | repl | try | test | export | import | info | check-baseline | check-upgrade | adopt | extract | import-history | migration | new | plan | verify | cache | cleanup} [options]")
 }
 
 // Search from the current directory backwards until we find a "pgpkg.toml" file,
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+	"os"
+)
+
+// Check the managed objects in the database for changes made outside of pgpkg.
+func doVerify(dsn string) {
+	if err := pgpkg.ParseArgs(""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	flagSet := flag.NewFlagSet("verify", flag.ExitOnError)
+	jsonFlag := flagSet.Bool("json", false, "print drift as JSON")
+	if err := flagSet.Parse(os.Args[2:]); err != nil {
+		pgpkg.Exit(fmt.Errorf("unable to parse arguments: %w", err))
+	}
+
+	pkgPath, err := findPkg(flagSet.Args())
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	p, err := pgpkg.NewProjectFrom(pkgPath)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	drift, err := p.Verify(dsn)
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+
+	if *jsonFlag {
+		if err = pgpkg.WriteDriftJSON(os.Stdout, drift); err != nil {
+			pgpkg.Exit(err)
+		}
+	} else {
+		for _, d := range drift {
+			fmt.Printf("%s: %s %s: %s\n", d.Package, d.ObjectType, d.ObjectName, d.Problem)
+		}
+	}
+
+	if len(drift) > 0 {
+		pgpkg.Exit(fmt.Errorf("found %d object(s) which differ from the managed state", len(drift)))
+	}
+
+	if !*jsonFlag {
+		fmt.Println("database matches the managed state")
+	}
+}
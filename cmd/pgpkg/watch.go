@@ -24,7 +24,7 @@ func NewWatch(pkgPath string) (*Watch, error) {
 	return &Watch{c: c}, nil
 }
 
-// Watch watches the filesystem for changes to ".sql" and ".toml" files.
+// Watch watches the filesystem for changes to ".sql", ".csv" and ".toml" files.
 // It waits a few moments after receiving a change event before calling
 // the action function. This is because changes are often clustered together.
 // For example, when editing a file in vi, we get several notifications of
@@ -41,7 +41,7 @@ func (w *Watch) Watch(then func([]notify.EventInfo)) {
 
 	for ei := range w.c {
 		ext := filepath.Ext(ei.Path())
-		if ext != ".sql" && ext != ".toml" {
+		if ext != ".sql" && ext != ".csv" && ext != ".toml" {
 			continue
 		}
 
@@ -0,0 +1,139 @@
+package pgpkg
+
+// Migrations can declare preconditions, which must be true before the migration is run,
+// and postconditions, which must be true after it has run. Conditions are SQL expressions
+// which are declared in the comment block at the top of the migration, or in a sibling file
+// with the same name and the extension ".check.sql":
+//
+//	--pgpkg:precondition not exists (select 1 from gl.entry where currency is null)
+//	--pgpkg:postcondition (select count(*) from gl.currency) > 0
+//
+// Each condition must fit on a single line.
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	preconditionKind  = "precondition"
+	postconditionKind = "postcondition"
+)
+
+var conditionPattern = regexp.MustCompile(`^--pgpkg:(precondition|postcondition)\s+(.*)$`)
+
+// A condition is a single SQL expression which is checked before or after a migration.
+type condition struct {
+	unit       *Unit  // unit in which the condition was declared
+	source     string // contents of the unit's file
+	lineNumber int    // line number of the declaration within the unit's file
+	kind       string // preconditionKind or postconditionKind
+	expr       string // SQL expression, which must evaluate to true
+}
+
+// Find the conditions declared in a unit. If headerOnly is set, only the comment block
+// at the top of the unit is searched; otherwise, the unit may only contain comments.
+// Line numbers are counted in the file itself, rather than in the unit's source, which
+// doesn't include leading blank lines.
+func parseConditions(u *Unit, headerOnly bool) ([]*condition, error) {
+	source, err := u.readFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ignored units don't have any conditions.
+	if strings.HasPrefix(strings.TrimSpace(source), "--pgpkg:ignore") {
+		return nil, nil
+	}
+
+	var conditions []*condition
+
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			if headerOnly {
+				break
+			}
+			return nil, PKGErrorf(u, nil, "check files may only contain comments, found: %s", line)
+		}
+
+		match := conditionPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		// A semicolon at the end of the condition isn't part of the expression.
+		expr := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(match[2]), ";"))
+		if expr == "" {
+			return nil, PKGErrorf(u, nil, "line %d: empty %s", i+1, match[1])
+		}
+
+		conditions = append(conditions, &condition{
+			unit:       u,
+			source:     source,
+			lineNumber: i + 1,
+			kind:       match[1],
+			expr:       expr,
+		})
+	}
+
+	return conditions, nil
+}
+
+// Check that the condition holds. The condition is evaluated in a savepoint, so an error
+// in the expression doesn't abort the transaction.
+func (c *condition) check(tx *PkgTx) error {
+	if _, err := tx.Exec("savepoint condition"); err != nil {
+		return fmt.Errorf("unable to begin savepoint: %w", err)
+	}
+
+	var result sql.NullBool
+	if err := tx.QueryRow(fmt.Sprintf("select (%s)::boolean", c.expr)).Scan(&result); err != nil {
+		if _, rberr := tx.Exec("rollback to savepoint condition"); rberr != nil {
+			return fmt.Errorf("unable to rollback to savepoint: %w", rberr)
+		}
+		return PKGErrorf(c, err, "unable to evaluate %s", c.kind)
+	}
+
+	if _, err := tx.Exec("release savepoint condition"); err != nil {
+		return fmt.Errorf("unable to release savepoint: %w", err)
+	}
+
+	if !result.Valid || !result.Bool {
+		return PKGErrorf(c, nil, "%s failed: %s", c.kind, c.expr)
+	}
+
+	return nil
+}
+
+// Check each condition of the given kind.
+func checkConditions(tx *PkgTx, conditions []*condition, kind string) error {
+	for _, c := range conditions {
+		if c.kind != kind {
+			continue
+		}
+
+		if c.unit.Bundle.Package.options().Verbose {
+			Verbose.Printf("%s: checking %s: %s\n", c.Location(), c.kind, c.expr)
+		}
+
+		if err := c.check(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *condition) Location() string {
+	return fmt.Sprintf("%s:%d", c.unit.Location(), c.lineNumber)
+}
+
+func (c *condition) DefaultContext() *PKGErrorContext {
+	return &PKGErrorContext{
+		Source:     c.source,
+		LineNumber: c.lineNumber,
+	}
+}
@@ -0,0 +1,30 @@
+package pgpkg
+
+import "testing"
+
+func TestConditionLineNumbers(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/conditions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := p.Root.Schema
+	conditions, err := schema.conditions(schema.Index["account@001.sql"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The check file starts with a blank line, which is counted.
+	lineNumbers := make(map[string]int)
+	for _, c := range conditions {
+		lineNumbers[c.kind] = c.lineNumber
+	}
+
+	if lineNumbers[preconditionKind] != 5 || lineNumbers[postconditionKind] != 6 {
+		t.Errorf("unexpected condition line numbers: %v", lineNumbers)
+	}
+}
@@ -4,8 +4,18 @@ import (
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"io"
+	"io/fs"
+	"path"
 )
 
+// Describes a CSV file containing reference data to be loaded into a table.
+type dataConfig struct {
+	Table  string `toml:"table"`            // qualified table name, e.g. "gl.currency"
+	File   string `toml:"file"`             // path to the CSV file
+	Mode   string `toml:"mode,omitempty"`   // "upsert" (the default) or "insert"
+	Delete bool   `toml:"delete,omitempty"` // delete rows that aren't in the CSV file
+}
+
 // Load the settings
 type configType struct {
 	Package    string
@@ -14,6 +24,19 @@ type configType struct {
 	Extensions []string
 	Uses       []string
 	Migrations []string
+
+	MigrationDir    string `toml:",omitempty"` // directory for new migrations; default is the directory of the last migration
+	MigrationPrefix string `toml:",omitempty"` // prefix for new migrations: "sequence" (the default) or "timestamp"
+
+	Repeatable []string // migrations that are run again whenever their contents change
+	Data       []dataConfig
+
+	Baseline        string `toml:",omitempty"` // consolidated migration script used for fresh installs
+	BaselineThrough string `toml:",omitempty"` // last migration included in the baseline; default is all of them
+
+	HistoryMap map[string]string `toml:",omitempty"` // maps other tools' migrations to ours, for pgpkg import-history
+
+	Tables string `toml:",omitempty"` // directory of declarative table definitions, for pgpkg migration generate
 }
 
 // Read a configuration TOML file and update the package accordingly.
@@ -46,6 +69,32 @@ func parseConfig(reader io.Reader) (*configType, error) {
 		}
 	}
 
+	for _, data := range config.Data {
+		if data.Table == "" || data.File == "" {
+			return nil, fmt.Errorf("data files in pgpkg.toml need both a table and a file")
+		}
+
+		if data.Mode != "" && data.Mode != dataModeUpsert && data.Mode != dataModeInsert {
+			return nil, fmt.Errorf("illegal data mode in pgpkg.toml: %s", data.Mode)
+		}
+	}
+
+	if config.MigrationDir != "" && (path.IsAbs(config.MigrationDir) || !fs.ValidPath(path.Clean(config.MigrationDir))) {
+		return nil, fmt.Errorf("illegal MigrationDir in pgpkg.toml: %s", config.MigrationDir)
+	}
+
+	if config.MigrationPrefix != "" && config.MigrationPrefix != migrationPrefixSequence && config.MigrationPrefix != migrationPrefixTimestamp {
+		return nil, fmt.Errorf("illegal MigrationPrefix in pgpkg.toml: %s", config.MigrationPrefix)
+	}
+
+	if config.Tables != "" && (path.IsAbs(config.Tables) || !fs.ValidPath(path.Clean(config.Tables))) {
+		return nil, fmt.Errorf("illegal Tables directory in pgpkg.toml: %s", config.Tables)
+	}
+
+	if config.BaselineThrough != "" && config.Baseline == "" {
+		return nil, fmt.Errorf("BaselineThrough requires a Baseline in pgpkg.toml")
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,262 @@
+package pgpkg
+
+// Reference data is loaded from CSV files into tables that are created by migrations.
+// Each file is listed in the Data section of pgpkg.toml, and is loaded every time the package
+// is deployed, after the migrations have been run.
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	dataModeUpsert = "upsert" // insert new rows, and update existing rows (the default)
+	dataModeInsert = "insert" // insert new rows, and leave existing rows alone
+)
+
+// Data is a bundle of CSV files, each of which is loaded into a single table.
+type Data struct {
+	*Bundle
+	files []*dataFile
+}
+
+// A dataFile describes how a single CSV unit is loaded.
+type dataFile struct {
+	unit   *Unit
+	schema string
+	table  string
+	mode   string
+	delete bool
+}
+
+// A column of a primary key.
+type keyColumn struct {
+	name    string
+	colType string
+}
+
+// Add a data file to the bundle. The table must be qualified with one of the package's schemas.
+func (d *Data) addDataFile(config dataConfig) error {
+	schema, table, ok := strings.Cut(config.Table, ".")
+	if !ok || schema == "" || table == "" || strings.Contains(table, ".") {
+		return fmt.Errorf("data table %s must be qualified with a schema name", config.Table)
+	}
+
+	if !d.Package.isValidSchema(schema) {
+		return fmt.Errorf("data table %s is not in a schema managed by %s", config.Table, d.Package.Name)
+	}
+
+	if _, ok := d.getUnit(config.File); ok {
+		return fmt.Errorf("duplicate data file %s", config.File)
+	}
+
+	if err := d.addUnit(config.File); err != nil {
+		return err
+	}
+
+	mode := config.Mode
+	if mode == "" {
+		mode = dataModeUpsert
+	}
+
+	d.files = append(d.files, &dataFile{
+		unit:   d.Index[config.File],
+		schema: schema,
+		table:  table,
+		mode:   mode,
+		delete: config.Delete,
+	})
+
+	return nil
+}
+
+func (df *dataFile) tableName() string {
+	return pq.QuoteIdentifier(df.schema) + "." + pq.QuoteIdentifier(df.table)
+}
+
+// Find the primary key columns of the table, in key order.
+func (df *dataFile) primaryKey(tx *PkgTx) ([]keyColumn, error) {
+	rows, err := tx.Query(`select a.attname, format_type(a.atttypid, a.atttypmod)
+		from pg_index i
+		join pg_attribute a on a.attrelid = i.indrelid and a.attnum = any(i.indkey)
+		where i.indrelid = $1::regclass and i.indisprimary
+		order by array_position(i.indkey::int2[], a.attnum)`, df.tableName())
+
+	if err != nil {
+		return nil, PKGErrorf(df.unit, err, "unable to find table %s.%s", df.schema, df.table)
+	}
+	defer rows.Close()
+
+	var keys []keyColumn
+	for rows.Next() {
+		var key keyColumn
+		if err = rows.Scan(&key.name, &key.colType); err != nil {
+			return nil, PKGErrorf(df.unit, err, "unable to read primary key")
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, PKGErrorf(df.unit, err, "unable to read primary key")
+	}
+
+	if len(keys) == 0 {
+		return nil, PKGErrorf(df.unit, nil, "table %s.%s has no primary key", df.schema, df.table)
+	}
+
+	return keys, nil
+}
+
+// Build the insert statement used to load each row.
+func (df *dataFile) insertStatement(header []string, keys []keyColumn) string {
+	var columns, params, updates, conflict []string
+
+	isKey := make(map[string]bool)
+	for _, key := range keys {
+		isKey[key.name] = true
+		conflict = append(conflict, pq.QuoteIdentifier(key.name))
+	}
+
+	for i, column := range header {
+		quoted := pq.QuoteIdentifier(column)
+		columns = append(columns, quoted)
+		params = append(params, fmt.Sprintf("$%d", i+1))
+		if !isKey[column] {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quoted, quoted))
+		}
+	}
+
+	action := "do nothing"
+	if df.mode == dataModeUpsert && len(updates) > 0 {
+		action = "do update set " + strings.Join(updates, ", ")
+	}
+
+	return fmt.Sprintf("insert into %s (%s) values (%s) on conflict (%s) %s",
+		df.tableName(), strings.Join(columns, ", "), strings.Join(params, ", "),
+		strings.Join(conflict, ", "), action)
+}
+
+// Delete any rows whose primary key doesn't appear in the file.
+func (df *dataFile) deleteMissing(tx *PkgTx, keys []keyColumn, keyValues [][]string) error {
+	var columns, casts, params, aliases []string
+	var args []any
+
+	for i, key := range keys {
+		alias := fmt.Sprintf("k%d", i+1)
+		columns = append(columns, pq.QuoteIdentifier(key.name))
+		casts = append(casts, fmt.Sprintf("%s::%s", alias, key.colType))
+		params = append(params, fmt.Sprintf("$%d::text[]", i+1))
+		aliases = append(aliases, alias)
+		args = append(args, pq.Array(keyValues[i]))
+	}
+
+	result, err := tx.Exec(fmt.Sprintf("delete from %s where (%s) not in (select %s from unnest(%s) as u(%s))",
+		df.tableName(), strings.Join(columns, ", "), strings.Join(casts, ", "),
+		strings.Join(params, ", "), strings.Join(aliases, ", ")), args...)
+
+	if err != nil {
+		return PKGErrorf(df.unit, err, "unable to delete rows from %s.%s", df.schema, df.table)
+	}
+
+	if df.unit.Bundle.Package.options().Verbose {
+		deleted, _ := result.RowsAffected()
+		Verbose.Printf("%s: deleted %d row(s) from %s.%s\n", df.unit.Path, deleted, df.schema, df.table)
+	}
+
+	return nil
+}
+
+// Load the CSV file into its table. The first row of the file contains the column names.
+// Empty fields are loaded as NULL.
+func (df *dataFile) load(tx *PkgTx) error {
+	r, err := df.unit.Bundle.Open(df.unit.Path)
+	if err != nil {
+		return PKGErrorf(df.unit, err, "unable to open")
+	}
+	defer r.Close()
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return PKGErrorf(df.unit, err, "unable to read CSV header")
+	}
+
+	keys, err := df.primaryKey(tx)
+	if err != nil {
+		return err
+	}
+
+	// Remember where each key column is in the file.
+	keyIndex := make([]int, len(keys))
+	for i, key := range keys {
+		keyIndex[i] = -1
+		for col, name := range header {
+			if name == key.name {
+				keyIndex[i] = col
+			}
+		}
+
+		if keyIndex[i] < 0 {
+			return PKGErrorf(df.unit, nil, "primary key column %s is missing from the CSV header", key.name)
+		}
+	}
+
+	insert := df.insertStatement(header, keys)
+	keyValues := make([][]string, len(keys))
+	rowCount := 0
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return PKGErrorf(df.unit, err, "unable to read CSV")
+		}
+
+		line, _ := reader.FieldPos(0)
+		args := make([]any, len(record))
+		for i, value := range record {
+			if value != "" {
+				args[i] = value
+			}
+		}
+
+		if _, err = tx.Exec(insert, args...); err != nil {
+			return PKGErrorf(df.unit, err, "unable to load line %d into %s.%s", line, df.schema, df.table)
+		}
+
+		for i, col := range keyIndex {
+			keyValues[i] = append(keyValues[i], record[col])
+		}
+
+		rowCount++
+	}
+
+	if df.unit.Bundle.Package.options().Verbose {
+		Verbose.Printf("%s: loaded %d row(s) into %s.%s\n", df.unit.Path, rowCount, df.schema, df.table)
+	}
+
+	if df.delete {
+		return df.deleteMissing(tx, keys, keyValues)
+	}
+
+	return nil
+}
+
+// Apply loads each of the data files, in the order they are declared.
+func (d *Data) Apply(tx *PkgTx) error {
+	for _, df := range d.files {
+		if err := df.load(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
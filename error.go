@@ -105,34 +105,45 @@ func PKGErrorf(object PKGObject, err error, msg string, args ...any) *PKGError {
 }
 
 func (c *PKGErrorContext) Print(contextLines int) {
-	sourceLine := c.LineNumber - 1
-
 	if c == nil {
 		return
 	}
 
-	if c != nil {
-		Stderr.Println(c.Location)
+	Stderr.Println(c.Location)
+	for _, line := range c.Excerpt(contextLines) {
+		Stderr.Println(line)
+	}
+
+	//trace := c
+	//for trace != nil {
+	//	fmt.Fprintln(os.Stderr, trace.Location)
+	//	trace = trace.Next
+	//}
+}
+
+// Excerpt returns the lines of source around the line where the error occurred, with
+// contextLines of context on either side. The line itself is marked with an arrow.
+func (c *PKGErrorContext) Excerpt(contextLines int) []string {
+	if c == nil {
+		return nil
 	}
 
+	sourceLine := c.LineNumber - 1
 	lines := strings.Split(c.Source, "\n")
 	lineCount := len(lines)
 
+	var excerpt []string
 	for cl := sourceLine - contextLines; cl <= sourceLine+contextLines; cl++ {
 		if cl >= 0 && cl < lineCount {
 			if cl != sourceLine {
-				Stderr.Printf("    %4d: %s\n", cl+1, lines[cl])
+				excerpt = append(excerpt, fmt.Sprintf("    %4d: %s", cl+1, lines[cl]))
 			} else {
-				Stderr.Printf("--> %4d: %s\n", cl+1, lines[cl])
+				excerpt = append(excerpt, fmt.Sprintf("--> %4d: %s", cl+1, lines[cl]))
 			}
 		}
 	}
 
-	//trace := c
-	//for trace != nil {
-	//	fmt.Fprintln(os.Stderr, trace.Location)
-	//	trace = trace.Next
-	//}
+	return excerpt
 }
 
 // Exit usually prints the error message (with context, if available), and then exits immediately with status 1.
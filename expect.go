@@ -0,0 +1,117 @@
+package pgpkg
+
+// Tests can declare that they are expected to fail, which is useful for checking that bad input
+// is rejected. A test whose name ends in "_fails_test" passes only if it raises an error.
+// Alternatively, an annotation in the comment block immediately before the test declares the
+// error that's expected; the SQLSTATE and the message pattern (a regular expression) are both optional:
+//
+//	--pgpkg:expect-error 23505 duplicate key
+//	create or replace function gl.duplicate_account_test() returns void ...
+//
+// Each annotation must fit on a single line.
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const failsTestSuffix = "_fails_test"
+
+var expectErrorPattern = regexp.MustCompile(`^--pgpkg:expect-error(\s+.*)?$`)
+var sqlStatePattern = regexp.MustCompile(`^[0-9A-Z]{5}$`)
+
+// An error that a test is expected to raise.
+type testExpectation struct {
+	sqlState string         // SQLSTATE of the error, if set
+	message  *regexp.Regexp // pattern matching the error message, if set
+}
+
+func (e *testExpectation) String() string {
+	var parts []string
+	if e.sqlState != "" {
+		parts = append(parts, e.sqlState)
+	}
+
+	if e.message != nil {
+		parts = append(parts, fmt.Sprintf("matching %q", e.message.String()))
+	}
+
+	if len(parts) == 0 {
+		return "an error"
+	}
+
+	return "error " + strings.Join(parts, " ")
+}
+
+// Find the error expected by a test, either from an annotation in the comment block
+// before the statement, or from the name of the test. Returns nil if the test isn't expected to fail.
+func parseExpectation(stmt *Statement, testName string) (*testExpectation, error) {
+	lines := strings.Split(stmt.Unit.Source, "\n")
+
+	// LineNumber is the first line of the statement itself, so search backwards from the line before.
+	for i := stmt.LineNumber - 2; i >= 0 && i < len(lines); i-- {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		match := expectErrorPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		expect := &testExpectation{}
+		args := strings.TrimSpace(match[1])
+		sqlState, rest, _ := strings.Cut(args, " ")
+		if sqlStatePattern.MatchString(sqlState) {
+			expect.sqlState = sqlState
+			args = strings.TrimSpace(rest)
+		}
+
+		if args != "" {
+			var err error
+			if expect.message, err = regexp.Compile(args); err != nil {
+				return nil, PKGErrorf(stmt, err, "line %d: invalid expect-error pattern", i+1)
+			}
+		}
+
+		return expect, nil
+	}
+
+	if strings.HasSuffix(testName, failsTestSuffix) {
+		return &testExpectation{}, nil
+	}
+
+	return nil, nil
+}
+
+// Check the result of a test against the expected error. Returns nil if the test raised the
+// expected error, or an error describing why it didn't.
+func (e *testExpectation) check(testErr error) error {
+	if testErr == nil {
+		return fmt.Errorf("expected %s, but the test completed normally", e)
+	}
+
+	if e.sqlState == "" && e.message == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(testErr, &pqErr) {
+		return testErr
+	}
+
+	if e.sqlState != "" && string(pqErr.Code) != e.sqlState {
+		return fmt.Errorf("expected %s, but got SQLSTATE %s: %w", e, pqErr.Code, testErr)
+	}
+
+	if e.message != nil && !e.message.MatchString(pqErr.Message) {
+		return fmt.Errorf("expected %s, but got: %w", e, testErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package pgpkg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTestExpectation(t *testing.T) {
+	u := &Unit{Source: "--pgpkg:expect-error 23505 duplicate key\nselect 1;\n"}
+	stmt := &Statement{Unit: u, LineNumber: 2}
+
+	expect, err := parseExpectation(stmt, "dup_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect == nil || expect.sqlState != "23505" || expect.message.String() != "duplicate key" {
+		t.Fatalf("unexpected expectation: %v", expect)
+	}
+
+	if err = expect.check(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}); err != nil {
+		t.Errorf("expected matching error to pass: %v", err)
+	}
+
+	if err = expect.check(&pq.Error{Code: "22012", Message: "division by zero"}); err == nil {
+		t.Error("expected error with the wrong SQLSTATE to fail")
+	}
+
+	if err = expect.check(nil); err == nil {
+		t.Error("expected test that completes normally to fail")
+	}
+
+	stmt = &Statement{Unit: &Unit{Source: "select 1;\n"}, LineNumber: 1}
+	if expect, _ = parseExpectation(stmt, "bad_input_fails_test"); expect == nil || expect.check(errors.New("any")) != nil {
+		t.Error("expected _fails_test to accept any error")
+	}
+
+	if expect, _ = parseExpectation(stmt, "ordinary_test"); expect != nil {
+		t.Error("expected ordinary test to have no expectation")
+	}
+}
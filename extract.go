@@ -0,0 +1,425 @@
+package pgpkg
+
+// Extract reverse-engineers a package from a schema in a live database. Functions, views and
+// triggers are written to individual files, which become the package's managed objects. Everything
+// else - types, sequences, tables, constraints, indexes and policies - is written to a single
+// migration script.
+//
+// The extracted package describes objects which already exist in the source database. Extract
+// doesn't change the database; to deploy the package to that database, it needs to be adopted
+// first (see Project.Adopt). The pgpkg extract command only does this when asked to, with --adopt.
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Find the extensions used by a schema, given by $1: those installed into the schema, and
+// those with members (such as types, functions and operator classes) which objects in the
+// schema depend on. Dependencies inside function bodies aren't recorded by PostgreSQL, so
+// extensions which are only used in functions aren't found.
+const extractExtensionsQuery = `
+	select e.extname
+	  from pg_extension e
+	 where e.extname <> 'plpgsql'
+	   and (e.extnamespace = (select oid from pg_namespace where nspname = $1)
+	        or exists (
+	           select 1
+	             from pg_depend m
+	             join pg_depend d on d.refclassid = m.classid and d.refobjid = m.objid and d.deptype in ('n', 'a')
+	            where m.refclassid = 'pg_extension'::regclass and m.refobjid = e.oid and m.deptype = 'e'
+	              and (select nspname from pg_namespace where oid = case d.classid
+	                     when 'pg_class'::regclass then (select relnamespace from pg_class where oid = d.objid)
+	                     when 'pg_proc'::regclass then (select pronamespace from pg_proc where oid = d.objid)
+	                     when 'pg_type'::regclass then (select typnamespace from pg_type where oid = d.objid)
+	                     when 'pg_constraint'::regclass then (select connamespace from pg_constraint where oid = d.objid)
+	                     when 'pg_attrdef'::regclass then (select c.relnamespace from pg_attrdef a join pg_class c on c.oid = a.adrelid where a.oid = d.objid)
+	                     when 'pg_rewrite'::regclass then (select c.relnamespace from pg_rewrite r join pg_class c on c.oid = r.ev_class where r.oid = d.objid)
+	                     when 'pg_trigger'::regclass then (select c.relnamespace from pg_trigger t join pg_class c on c.oid = t.tgrelid where t.oid = d.objid)
+	                   end) = $1))
+	 order by e.extname`
+
+// The migration script written by Extract, relative to the package directory.
+const extractMigrationPath = "schema/baseline.sql"
+
+// Each of these queries returns statements, in order, for the migration script.
+// The schema name is given by $1.
+var extractMigrationQueries = []struct {
+	comment string
+	query   string
+}{
+	{"enum types", `
+		select 'create type ' || t.oid::regtype::text || ' as enum ('
+		         || coalesce((select string_agg(quote_literal(e.enumlabel), ', ' order by e.enumsortorder)
+		                        from pg_enum e where e.enumtypid = t.oid), '') || ');'
+		  from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		 where n.nspname = $1 and t.typtype = 'e' and not ` + extractIsExtension("pg_type", "t.oid") + `
+		 order by t.oid`},
+
+	{"range types", `
+		select 'create type ' || t.oid::regtype::text || ' as range (subtype = ' || format_type(r.rngsubtype, null) || ');'
+		  from pg_type t join pg_namespace n on n.oid = t.typnamespace join pg_range r on r.rngtypid = t.oid
+		 where n.nspname = $1 and t.typtype = 'r' and not ` + extractIsExtension("pg_type", "t.oid") + `
+		 order by t.oid`},
+
+	{"domains", `
+		select 'create domain ' || t.oid::regtype::text || ' as ' || format_type(t.typbasetype, t.typtypmod)
+		         || coalesce(' default ' || t.typdefault, '')
+		         || case when t.typnotnull then ' not null' else '' end
+		         || coalesce((select string_agg(' constraint ' || quote_ident(con.conname) || ' ' || pg_get_constraintdef(con.oid), '' order by con.oid)
+		                        from pg_constraint con where con.contypid = t.oid and con.contype = 'c'), '') || ';'
+		  from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		 where n.nspname = $1 and t.typtype = 'd' and not ` + extractIsExtension("pg_type", "t.oid") + `
+		 order by t.oid`},
+
+	{"composite types", `
+		select 'create type ' || c.reltype::regtype::text || ' as (' || coalesce((
+		         select string_agg(quote_ident(a.attname) || ' ' || format_type(a.atttypid, a.atttypmod), ', ' order by a.attnum)
+		           from pg_attribute a where a.attrelid = c.oid and a.attnum > 0 and not a.attisdropped), '') || ');'
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and c.relkind = 'c' and not ` + extractIsExtension("pg_class", "c.oid") + `
+		 order by c.oid`},
+
+	{"sequences", `
+		select 'create sequence ' || c.oid::regclass::text || ' as ' || format_type(s.seqtypid, null)
+		         || ' increment by ' || s.seqincrement || ' minvalue ' || s.seqmin || ' maxvalue ' || s.seqmax
+		         || ' start with ' || s.seqstart || ' cache ' || s.seqcache
+		         || case when s.seqcycle then ' cycle' else '' end || ';'
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace join pg_sequence s on s.seqrelid = c.oid
+		 where n.nspname = $1 and c.relkind = 'S'
+		   and not exists (select 1 from pg_depend d
+		                    where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype in ('i', 'e'))
+		 order by c.oid`},
+
+	{"tables", `
+		select 'create table ' || c.oid::regclass::text || ' (' || coalesce(E'\n    ' || (
+		         select string_agg(quote_ident(a.attname) || ' ' || format_type(a.atttypid, a.atttypmod)
+		                  || case when a.attcollation <> 0 and a.attcollation <> t.typcollation
+		                          then ' collate ' || a.attcollation::regcollation::text else '' end
+		                  || case a.attidentity when 'a' then ' generated always as identity'
+		                                        when 'd' then ' generated by default as identity' else '' end
+		                  || case when a.attgenerated = 's' then ' generated always as (' || pg_get_expr(d.adbin, d.adrelid) || ') stored'
+		                          when d.adbin is not null then ' default ' || pg_get_expr(d.adbin, d.adrelid) else '' end
+		                  || case when a.attnotnull then ' not null' else '' end,
+		                  E',\n    ' order by a.attnum)
+		           from pg_attribute a
+		           join pg_type t on t.oid = a.atttypid
+		           left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+		          where a.attrelid = c.oid and a.attnum > 0 and not a.attisdropped), '') || E'\n)'
+		         || case when c.relkind = 'p' then ' partition by ' || pg_get_partkeydef(c.oid) else '' end || ';'
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and c.relkind in ('r', 'p') and not c.relispartition
+		   and not ` + extractIsExtension("pg_class", "c.oid") + `
+		 order by c.oid`},
+
+	{"partitions", `
+		select 'create table ' || c.oid::regclass::text || ' partition of ' || i.inhparent::regclass::text
+		         || ' ' || pg_get_expr(c.relpartbound, c.oid) || ';'
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace join pg_inherits i on i.inhrelid = c.oid
+		 where n.nspname = $1 and c.relkind in ('r', 'p') and c.relispartition
+		 order by c.oid`},
+
+	{"sequence ownership", `
+		select 'alter sequence ' || c.oid::regclass::text || ' owned by '
+		         || d.refobjid::regclass::text || '.' || quote_ident(a.attname) || ';'
+		  from pg_class c
+		  join pg_namespace n on n.oid = c.relnamespace
+		  join pg_depend d on d.classid = 'pg_class'::regclass and d.objid = c.oid
+		                  and d.refclassid = 'pg_class'::regclass and d.deptype = 'a'
+		  join pg_attribute a on a.attrelid = d.refobjid and a.attnum = d.refobjsubid
+		 where n.nspname = $1 and c.relkind = 'S'
+		 order by c.oid`},
+
+	{"constraints", `
+		select 'alter table ' || con.conrelid::regclass::text || ' add constraint ' || quote_ident(con.conname)
+		         || ' ' || pg_get_constraintdef(con.oid) || ';'
+		  from pg_constraint con join pg_namespace n on n.oid = con.connamespace
+		 where n.nspname = $1 and con.conrelid <> 0 and con.contype in ('p', 'u', 'c', 'x')
+		   and con.conislocal and con.conparentid = 0
+		 order by con.conrelid, con.contype desc, con.oid`},
+
+	{"indexes", `
+		select pg_get_indexdef(i.indexrelid) || ';'
+		  from pg_index i join pg_class c on c.oid = i.indexrelid join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1
+		   and not exists (select 1 from pg_constraint con
+		                    where con.conindid = i.indexrelid and con.contype in ('p', 'u', 'x'))
+		   and not exists (select 1 from pg_inherits h where h.inhrelid = i.indexrelid)
+		 order by i.indexrelid`},
+
+	{"foreign keys", `
+		select 'alter table ' || con.conrelid::regclass::text || ' add constraint ' || quote_ident(con.conname)
+		         || ' ' || pg_get_constraintdef(con.oid) || ';'
+		  from pg_constraint con join pg_namespace n on n.oid = con.connamespace
+		 where n.nspname = $1 and con.contype = 'f' and con.conparentid = 0
+		 order by con.conrelid, con.oid`},
+
+	{"row level security", `
+		select 'alter table ' || c.oid::regclass::text || ' enable row level security;'
+		         || case when c.relforcerowsecurity
+		                 then E'\nalter table ' || c.oid::regclass::text || ' force row level security;' else '' end
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and c.relrowsecurity
+		 order by c.oid`},
+
+	{"policies", `
+		select 'create policy ' || quote_ident(p.polname) || ' on ' || p.polrelid::regclass::text
+		         || case when p.polpermissive then '' else ' as restrictive' end
+		         || case p.polcmd when 'r' then ' for select' when 'a' then ' for insert'
+		                          when 'w' then ' for update' when 'd' then ' for delete' else '' end
+		         || ' to ' || case when p.polroles = '{0}' then 'public'
+		                      else (select string_agg(quote_ident(r.rolname), ', ') from pg_roles r where r.oid = any(p.polroles)) end
+		         || coalesce(' using (' || pg_get_expr(p.polqual, p.polrelid) || ')', '')
+		         || coalesce(' with check (' || pg_get_expr(p.polwithcheck, p.polrelid) || ')', '') || ';'
+		  from pg_policy p join pg_class c on c.oid = p.polrelid join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1
+		 order by p.polrelid, p.oid`},
+
+	{"materialized views", `
+		select 'create materialized view ' || c.oid::regclass::text || E' as\n'
+		         || regexp_replace(pg_get_viewdef(c.oid), ';\s*$', '') || ';'
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and c.relkind = 'm'
+		 order by c.oid`},
+
+	{"comments", `
+		select 'comment on ' || case when d.objsubid = 0 then 'table ' || c.oid::regclass::text
+		                             else 'column ' || c.oid::regclass::text || '.' || quote_ident(a.attname) end
+		         || ' is ' || quote_literal(d.description) || ';'
+		  from pg_description d
+		  join pg_class c on d.classoid = 'pg_class'::regclass and d.objoid = c.oid
+		  join pg_namespace n on n.oid = c.relnamespace
+		  left join pg_attribute a on a.attrelid = c.oid and a.attnum = d.objsubid
+		 where n.nspname = $1 and c.relkind in ('r', 'p')
+		 order by c.oid, d.objsubid`},
+}
+
+// Each of these queries returns (name, definition) pairs for the managed objects in the schema,
+// which are written to individual files in the given directory.
+var extractObjectQueries = []struct {
+	dir   string
+	query string
+}{
+	{"functions", `
+		select p.proname, pg_get_functiondef(p.oid) || ';'
+		  from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+		 where n.nspname = $1 and p.prokind in ('f', 'p') and not ` + extractIsExtension("pg_proc", "p.oid") + `
+		 order by p.proname, p.oid`},
+
+	{"views", `
+		select c.relname, 'create or replace view ' || c.oid::regclass::text || E' as\n' || pg_get_viewdef(c.oid)
+		  from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and c.relkind = 'v' and not ` + extractIsExtension("pg_class", "c.oid") + `
+		 order by c.relname`},
+
+	{"triggers", `
+		select c.relname || '_' || t.tgname, pg_get_triggerdef(t.oid) || ';'
+		  from pg_trigger t join pg_class c on c.oid = t.tgrelid join pg_namespace n on n.oid = c.relnamespace
+		 where n.nspname = $1 and not t.tgisinternal and t.tgparentid = 0
+		 order by c.relname, t.tgname`},
+}
+
+// Return an expression which is true if the object is a member of an extension.
+func extractIsExtension(catalog string, oid string) string {
+	return fmt.Sprintf("exists (select 1 from pg_depend e where e.classid = '%s'::regclass and e.objid = %s and e.deptype = 'e')",
+		catalog, oid)
+}
+
+var extractFilenamePattern = regexp.MustCompile("[^a-zA-Z0-9_]+")
+
+// Run a query and return the values of each row as strings.
+func extractRows(tx *sql.Tx, query string, args ...any) ([][]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var results [][]string
+	for rows.Next() {
+		values := make([]string, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		results = append(results, values)
+	}
+
+	return results, rows.Err()
+}
+
+func writeExtractFile(dir string, filePath string, contents string) error {
+	fullPath := path.Join(dir, filePath)
+	if err := os.MkdirAll(path.Dir(fullPath), 0777); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(fullPath, []byte(strings.TrimSpace(contents)+"\n"), 0666); err != nil {
+		return fmt.Errorf("unable to write %s: %w", fullPath, err)
+	}
+
+	return nil
+}
+
+// Choose a unique filename for an object. Files ending in "_test.sql" are tests, so they are avoided.
+func extractFilename(dir string, name string, used map[string]bool) string {
+	base := strings.Trim(extractFilenamePattern.ReplaceAllString(name, "_"), "_")
+	if base == "" || strings.HasSuffix(base, "_test") {
+		base = base + "_obj"
+	}
+
+	filename := path.Join(dir, base+".sql")
+	for i := 2; used[filename]; i++ {
+		filename = path.Join(dir, fmt.Sprintf("%s_%d.sql", base, i))
+	}
+
+	used[filename] = true
+	return filename
+}
+
+// Extract writes a package to dir which describes the given schema in the database. If pkgName
+// is empty, the schema name is used as the package name. The directory must not already contain
+// a package.
+func Extract(dsn string, schema string, pkgName string, dir string) error {
+	if pkgName == "" {
+		pkgName = schema
+	}
+
+	if err := CheckPackageName(pkgName); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path.Join(dir, "pgpkg.toml")); err == nil {
+		return fmt.Errorf("%s already contains a package", dir)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	// Nothing is written to the database.
+	defer tx.Rollback()
+
+	// Definitions are qualified with their schema names, unless they are in the search path.
+	if _, err = tx.Exec("set local search_path to pg_catalog"); err != nil {
+		return fmt.Errorf("unable to set search path: %w", err)
+	}
+
+	var exists bool
+	if err = tx.QueryRow("select exists (select 1 from pg_namespace where nspname = $1)", schema).Scan(&exists); err != nil {
+		return fmt.Errorf("unable to find schema %s: %w", schema, err)
+	}
+
+	if !exists {
+		return fmt.Errorf("schema %s not found", schema)
+	}
+
+	var extensions []string
+	extRows, err := extractRows(tx, extractExtensionsQuery, schema)
+	if err != nil {
+		return fmt.Errorf("unable to read extensions: %w", err)
+	}
+	for _, row := range extRows {
+		extensions = append(extensions, row[0])
+	}
+
+	// Write the migration script.
+	var migration strings.Builder
+
+	for _, q := range extractMigrationQueries {
+		rows, err := extractRows(tx, q.query, schema)
+		if err != nil {
+			return fmt.Errorf("unable to extract %s: %w", q.comment, err)
+		}
+
+		if len(rows) == 0 {
+			continue
+		}
+
+		if migration.Len() == 0 {
+			fmt.Fprintf(&migration, "--\n-- Tables and types extracted from schema %s.\n--\n", schema)
+		}
+
+		fmt.Fprintf(&migration, "\n-- %s\n", q.comment)
+		for _, row := range rows {
+			migration.WriteString(row[0] + "\n")
+		}
+	}
+
+	var migrations []string
+	if migration.Len() > 0 {
+		if err = writeExtractFile(dir, extractMigrationPath, migration.String()); err != nil {
+			return err
+		}
+		migrations = append(migrations, extractMigrationPath)
+	}
+
+	// Write the managed objects, one per file.
+	used := make(map[string]bool)
+	objectCount := 0
+
+	for _, q := range extractObjectQueries {
+		rows, err := extractRows(tx, q.query, schema)
+		if err != nil {
+			return fmt.Errorf("unable to extract %s: %w", q.dir, err)
+		}
+
+		for _, row := range rows {
+			if err = writeExtractFile(dir, extractFilename(q.dir, row[0], used), row[1]); err != nil {
+				return err
+			}
+			objectCount++
+		}
+	}
+
+	// Aggregates can't be managed objects, and there's no way to get their definitions.
+	var aggregateCount int
+	if err = tx.QueryRow("select count(*) from pg_proc p join pg_namespace n on n.oid = p.pronamespace "+
+		"where n.nspname = $1 and p.prokind = 'a'", schema).Scan(&aggregateCount); err != nil {
+		return fmt.Errorf("unable to count aggregates: %w", err)
+	}
+
+	if aggregateCount > 0 {
+		Stderr.Printf("warning: %d aggregate(s) in schema %s were not extracted\n", aggregateCount, schema)
+	}
+
+	config := &configType{
+		Package:    pkgName,
+		Schemas:    []string{schema},
+		Extensions: extensions,
+		Migrations: migrations,
+	}
+
+	configFile, err := os.Create(path.Join(dir, "pgpkg.toml"))
+	if err != nil {
+		return fmt.Errorf("unable to create config file: %w", err)
+	}
+	defer configFile.Close()
+
+	if err = config.writeConfig(configFile); err != nil {
+		return fmt.Errorf("unable to write config file: %w", err)
+	}
+
+	Stdout.Printf("extracted schema %s into %s: %d managed object(s)\n", schema, dir, objectCount)
+	return nil
+}
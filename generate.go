@@ -0,0 +1,347 @@
+package pgpkg
+
+// Migrations can be generated from declarative table definitions. A package can keep a
+// CREATE TABLE statement for each of its tables in the directory named by Tables in
+// pgpkg.toml. These files aren't run during deployment; instead, they describe how the
+// tables should look after the next migration.
+//
+// To generate a migration, the package's migrations are deployed into a database (normally
+// a temporary one), and the tables it contains are compared with the declarations:
+//
+//   - tables that don't exist are created using the declaration itself;
+//   - columns that don't exist are added;
+//   - columns that aren't declared are dropped;
+//   - columns whose type, nullability or default has changed are altered.
+//
+// Columns are compared by creating a temporary table from the declaration, so that types
+// and default expressions are formatted by Postgres in the same way for both tables.
+// Constraints and indexes are only used when a table is created; changes to them need
+// to be written by hand.
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// The name of the temporary table used to compare column definitions.
+const generateTempTable = "pgpkg_generate"
+
+// A column, as described by the catalog.
+type generateColumn struct {
+	name      string
+	typeName  string
+	notNull   bool
+	def       string // default or generated expression
+	identity  string
+	generated string
+}
+
+// Read the columns of a table from the catalog, in order.
+func readGenerateColumns(tx *PkgTx, tableName string) ([]*generateColumn, error) {
+	rows, err := tx.Query(`select a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+	                              coalesce(pg_get_expr(d.adbin, d.adrelid), ''), a.attidentity::text, a.attgenerated::text
+	                         from pg_attribute a
+	                         left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+	                        where a.attrelid = $1::regclass and a.attnum > 0 and not a.attisdropped
+	                        order by a.attnum`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read columns of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var columns []*generateColumn
+	for rows.Next() {
+		c := &generateColumn{}
+		if err = rows.Scan(&c.name, &c.typeName, &c.notNull, &c.def, &c.identity, &c.generated); err != nil {
+			return nil, fmt.Errorf("unable to read columns of %s: %w", tableName, err)
+		}
+		columns = append(columns, c)
+	}
+
+	return columns, rows.Err()
+}
+
+// Deparse a single statement.
+func deparseNode(node *pg_query.Node) (string, error) {
+	return Deparse(&pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{Stmt: node}}})
+}
+
+// Create a temporary table with the same columns as the declaration. Only the column types,
+// defaults, nullability and identity are copied; other constraints are ignored.
+func createGenerateTempTable(tx *PkgTx, stmt *Statement, createStmt *pg_query.CreateStmt) error {
+	tempStmt := &pg_query.CreateStmt{
+		Relation: &pg_query.RangeVar{Relname: generateTempTable, Inh: true, Relpersistence: "t"},
+	}
+
+	for _, elt := range createStmt.TableElts {
+		colDef := elt.GetColumnDef()
+		if colDef == nil {
+			continue
+		}
+
+		var constraints []*pg_query.Node
+		for _, c := range colDef.Constraints {
+			switch c.GetConstraint().GetContype() {
+			case pg_query.ConstrType_CONSTR_NULL, pg_query.ConstrType_CONSTR_NOTNULL, pg_query.ConstrType_CONSTR_DEFAULT,
+				pg_query.ConstrType_CONSTR_IDENTITY, pg_query.ConstrType_CONSTR_GENERATED:
+				constraints = append(constraints, c)
+			}
+		}
+
+		tempStmt.TableElts = append(tempStmt.TableElts, &pg_query.Node{
+			Node: &pg_query.Node_ColumnDef{
+				ColumnDef: &pg_query.ColumnDef{
+					Colname:     colDef.Colname,
+					TypeName:    colDef.TypeName,
+					CollClause:  colDef.CollClause,
+					Constraints: constraints,
+					IsLocal:     true,
+				},
+			},
+		})
+	}
+
+	source, err := deparseNode(&pg_query.Node{Node: &pg_query.Node_CreateStmt{CreateStmt: tempStmt}})
+	if err != nil {
+		return PKGErrorf(stmt, err, "unable to generate temporary table")
+	}
+
+	if _, err = tx.Exec(source); err != nil {
+		return PKGErrorf(stmt, err, "unable to create temporary table from declaration")
+	}
+
+	return nil
+}
+
+// Generate the statement used to add a declared column to an existing table.
+func addColumnSQL(stmt *Statement, relation *pg_query.RangeVar, colDef *pg_query.ColumnDef) (string, error) {
+	alterStmt := &pg_query.AlterTableStmt{
+		Relation: relation,
+		Objtype:  pg_query.ObjectType_OBJECT_TABLE,
+		Cmds: []*pg_query.Node{{
+			Node: &pg_query.Node_AlterTableCmd{
+				AlterTableCmd: &pg_query.AlterTableCmd{
+					Subtype: pg_query.AlterTableType_AT_AddColumn,
+					Def:     &pg_query.Node{Node: &pg_query.Node_ColumnDef{ColumnDef: colDef}},
+				},
+			},
+		}},
+	}
+
+	source, err := deparseNode(&pg_query.Node{Node: &pg_query.Node_AlterTableStmt{AlterTableStmt: alterStmt}})
+	if err != nil {
+		return "", PKGErrorf(stmt, err, "unable to generate column %s", colDef.Colname)
+	}
+
+	return source + ";", nil
+}
+
+// Compare a declared column with an existing one, and return the statements needed
+// to update the existing column. Changes that can't be made automatically are returned as comments.
+func alterColumnSQL(tableName string, declared *generateColumn, existing *generateColumn) []string {
+	var statements []string
+	alter := fmt.Sprintf("alter table %s alter column %s", tableName, quote(declared.name))
+
+	if declared.identity != existing.identity || declared.generated != existing.generated {
+		return []string{fmt.Sprintf("-- %s.%s: identity or generated expression has changed; update it by hand", tableName, declared.name)}
+	}
+
+	// The existing values are cast to the new type, which fails if any of them can't be converted.
+	if declared.typeName != existing.typeName {
+		statements = append(statements, fmt.Sprintf("%s type %s using %s::%s;", alter, declared.typeName, quote(declared.name), declared.typeName))
+	}
+
+	// Sequence names differ between the two tables, so serial columns are assumed to be the same.
+	sameSequence := strings.HasPrefix(declared.def, "nextval(") && strings.HasPrefix(existing.def, "nextval(")
+	if declared.def != existing.def && !sameSequence {
+		if declared.generated != "" {
+			statements = append(statements, fmt.Sprintf("-- %s.%s: generated expression has changed; update it by hand", tableName, declared.name))
+		} else if declared.def == "" {
+			statements = append(statements, fmt.Sprintf("%s drop default;", alter))
+		} else {
+			statements = append(statements, fmt.Sprintf("%s set default %s;", alter, declared.def))
+		}
+	}
+
+	if declared.notNull != existing.notNull && declared.identity == "" {
+		if declared.notNull {
+			statements = append(statements, fmt.Sprintf("%s set not null;", alter))
+		} else {
+			statements = append(statements, fmt.Sprintf("%s drop not null;", alter))
+		}
+	}
+
+	return statements
+}
+
+// Generate the statements needed to make an existing table match its declaration.
+func generateTable(tx *PkgTx, stmt *Statement, createStmt *pg_query.CreateStmt, tableName string) ([]string, error) {
+	if err := createGenerateTempTable(tx, stmt, createStmt); err != nil {
+		return nil, err
+	}
+
+	declaredColumns, err := readGenerateColumns(tx, "pg_temp."+generateTempTable)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("drop table pg_temp." + generateTempTable); err != nil {
+		return nil, fmt.Errorf("unable to drop temporary table: %w", err)
+	}
+
+	existingColumns, err := readGenerateColumns(tx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]*generateColumn)
+	for _, c := range existingColumns {
+		existing[c.name] = c
+	}
+
+	declared := make(map[string]*generateColumn)
+	for _, c := range declaredColumns {
+		declared[c.name] = c
+	}
+
+	var statements []string
+
+	for _, elt := range createStmt.TableElts {
+		colDef := elt.GetColumnDef()
+		if colDef == nil {
+			continue
+		}
+
+		existingColumn, ok := existing[colDef.Colname]
+		if !ok {
+			addColumn, err := addColumnSQL(stmt, createStmt.Relation, colDef)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, addColumn)
+			continue
+		}
+
+		statements = append(statements, alterColumnSQL(tableName, declared[colDef.Colname], existingColumn)...)
+	}
+
+	// Dropping a column loses its data, so columns which aren't declared are only dropped
+	// if the generated statement is uncommented.
+	for _, c := range existingColumns {
+		if _, ok := declared[c.name]; !ok {
+			Stderr.Printf("warning: column %s.%s is not declared; uncomment the drop column statement to drop it\n", tableName, quote(c.name))
+			statements = append(statements,
+				fmt.Sprintf("-- %s.%s is not declared; dropping it loses its data, so uncomment this to drop it", tableName, quote(c.name)),
+				fmt.Sprintf("-- alter table %s drop column %s;", tableName, quote(c.name)))
+		}
+	}
+
+	return statements, nil
+}
+
+// Load the declarative table definitions from the package's Tables directory.
+func (p *Package) loadTables() (*Bundle, error) {
+	tables := p.newBundle()
+
+	err := fs.WalkDir(p.Source, path.Clean(p.config.Tables), func(unitPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".sql") {
+			return tables.addUnit(unitPath)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table definitions for package %s: %w", p.Name, err)
+	}
+
+	return tables, nil
+}
+
+// GenerateMigration compares the declarative table definitions in the package's Tables directory
+// with the tables in the database given by dsn, and returns a migration script that would make the tables match
+// the declarations. The database should contain the package with all of its migrations applied;
+// normally it's a temporary database. The database is not changed.
+//
+// Returns an empty string if no changes are needed.
+func (p *Package) GenerateMigration(dsn string) (string, error) {
+	if p.config.Tables == "" {
+		return "", fmt.Errorf("package %s does not declare a Tables directory", p.Name)
+	}
+
+	tables, err := p.loadTables()
+	if err != nil {
+		return "", err
+	}
+
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	// Nothing is changed; the temporary table is removed when the transaction is rolled back.
+	defer dbtx.Rollback()
+	tx := &PkgTx{Tx: dbtx, options: p.options()}
+
+	// Types and expressions are qualified with their schema names, unless they are in the search path.
+	if _, err = tx.Exec("set local search_path to pg_catalog"); err != nil {
+		return "", fmt.Errorf("unable to set search path: %w", err)
+	}
+
+	var script []string
+	for _, unit := range tables.Units {
+		if err = unit.Parse(); err != nil {
+			return "", err
+		}
+
+		for _, stmt := range unit.Statements {
+			createStmt := stmt.Tree.Stmt.GetCreateStmt()
+			if createStmt == nil {
+				return "", PKGErrorf(stmt, nil, "only CREATE TABLE statements can be used in table definitions")
+			}
+
+			relation := createStmt.Relation
+			if !p.isValidSchema(relation.Schemaname) {
+				return "", PKGErrorf(stmt, nil, "table %s must be in one of the schemas of package %s", relation.Relname, p.Name)
+			}
+
+			tableName := quote(relation.Schemaname) + "." + quote(relation.Relname)
+
+			var exists bool
+			if err = tx.QueryRow("select to_regclass($1) is not null", tableName).Scan(&exists); err != nil {
+				return "", PKGErrorf(stmt, err, "unable to find table %s", tableName)
+			}
+
+			if !exists {
+				script = append(script, strings.TrimSuffix(strings.TrimSpace(stmt.Source), ";")+";")
+				continue
+			}
+
+			statements, err := generateTable(tx, stmt, createStmt, tableName)
+			if err != nil {
+				return "", err
+			}
+			script = append(script, statements...)
+		}
+	}
+
+	if len(script) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(script, "\n\n") + "\n", nil
+}
@@ -0,0 +1,302 @@
+package pgpkg
+
+// Migration history can be imported from other migration tools, so that a database managed by
+// another tool can be switched to pgpkg without running its migrations again. Each migration
+// recorded in the other tool's history table is mapped to an entry in the package's Migrations
+// list, which is then recorded in pgpkg.migration.
+//
+// Migrations are mapped using, in order of preference:
+//
+//   - the HistoryMap table in pgpkg.toml, which maps another tool's script name or version
+//     to the filename of a migration;
+//   - the filename of the other tool's script;
+//   - the version prefix of the filename, such as "42" in "0042_backfill.sql".
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A historyEntry is a migration recorded by another tool.
+type historyEntry struct {
+	version string // version of the migration, if the tool uses versions
+	name    string // filename or change name of the migration, if known
+}
+
+func (e historyEntry) String() string {
+	switch {
+	case e.name == "":
+		return e.version
+	case e.version == "":
+		return e.name
+	default:
+		return e.version + " (" + e.name + ")"
+	}
+}
+
+// A historyTool describes how to read the history table of another migration tool.
+type historyTool struct {
+	table  string // default name of the history table
+	query  string // query returning (version, name) for each applied migration; %s is the table name
+	linear bool   // history records only the latest version; all earlier migrations are also applied
+
+	// If set, the history table is shared by several projects, and the query selects the
+	// migrations of the project given by $1, which is stored in this column.
+	projectColumn string
+}
+
+var historyTools = map[string]historyTool{
+	"flyway": {
+		table: "flyway_schema_history",
+		query: "select coalesce(version, ''), coalesce(script, '') from %s where success order by installed_rank",
+	},
+	"golang-migrate": {
+		table:  "schema_migrations",
+		query:  "select version::text, '' from %s",
+		linear: true,
+	},
+	"sqitch": {
+		table:         "sqitch.changes",
+		query:         "select '', change || '.sql' from %s where project = $1 order by committed_at",
+		projectColumn: "project",
+	},
+}
+
+var historyTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+var versionPrefixPattern = regexp.MustCompile(`^[vV]?([0-9]+(?:[._][0-9]+)*)`)
+
+// Normalise a version so that versions written in different styles can be compared;
+// for example, "0042" and "42", or "1_2" and "1.2".
+func normaliseVersion(version string) string {
+	parts := strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '_'
+	})
+
+	for i, part := range parts {
+		parts[i] = strings.TrimLeft(part, "0")
+		if parts[i] == "" {
+			parts[i] = "0"
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// Return the normalised version prefix of a migration filename, or "" if it doesn't have one.
+func migrationVersion(name string) string {
+	match := versionPrefixPattern.FindStringSubmatch(name)
+	if match == nil {
+		return ""
+	}
+
+	return normaliseVersion(match[1])
+}
+
+// Find the migration that corresponds to a history entry. Returns the filename of the migration.
+func matchHistoryEntry(entry historyEntry, migrations []string, historyMap map[string]string) (string, bool) {
+	isMigration := func(name string) bool {
+		for _, migrationPath := range migrations {
+			if filepath.Base(migrationPath) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, key := range []string{entry.name, entry.version} {
+		if target, ok := historyMap[key]; ok && key != "" {
+			target = filepath.Base(target)
+			return target, isMigration(target)
+		}
+	}
+
+	if entry.name != "" && isMigration(filepath.Base(entry.name)) {
+		return filepath.Base(entry.name), true
+	}
+
+	if version := normaliseVersion(entry.version); version != "" {
+		for _, migrationPath := range migrations {
+			name := filepath.Base(migrationPath)
+			if migrationVersion(name) == version {
+				return name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Map history entries to migrations. Returns the filenames of the migrations which have been
+// applied, in the order they appear in migrations, and the entries which couldn't be mapped.
+// If linear is set, each entry also implies that every earlier migration has been applied.
+func mapHistory(entries []historyEntry, migrations []string, historyMap map[string]string, linear bool) ([]string, []historyEntry) {
+	appliedSet := make(map[string]bool)
+	var unmatched []historyEntry
+
+	for _, entry := range entries {
+		name, ok := matchHistoryEntry(entry, migrations, historyMap)
+		if !ok {
+			unmatched = append(unmatched, entry)
+			continue
+		}
+
+		appliedSet[name] = true
+
+		if linear {
+			for _, migrationPath := range migrations {
+				migrationName := filepath.Base(migrationPath)
+				appliedSet[migrationName] = true
+				if migrationName == name {
+					break
+				}
+			}
+		}
+	}
+
+	var applied []string
+	for _, migrationPath := range migrations {
+		if name := filepath.Base(migrationPath); appliedSet[name] {
+			applied = append(applied, name)
+		}
+	}
+
+	return applied, unmatched
+}
+
+// Read the history table of another migration tool.
+func readHistory(tx *PkgTx, tool historyTool, table string, args ...any) ([]historyEntry, error) {
+	rows, err := tx.Query(fmt.Sprintf(tool.query, table), args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var entries []historyEntry
+	for rows.Next() {
+		var entry historyEntry
+		if err = rows.Scan(&entry.version, &entry.name); err != nil {
+			return nil, fmt.Errorf("unable to read history table %s: %w", table, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Work out which project's history to import from a history table shared by several projects.
+// If project is empty, the table must contain the history of a single project.
+func findHistoryProject(tx *PkgTx, tool historyTool, table string, project string) (string, error) {
+	if project != "" {
+		return project, nil
+	}
+
+	rows, err := tx.Query(fmt.Sprintf("select distinct %s from %s order by 1", tool.projectColumn, table))
+	if err != nil {
+		return "", fmt.Errorf("unable to read history table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var projects []string
+	for rows.Next() {
+		var historyProject string
+		if err = rows.Scan(&historyProject); err != nil {
+			return "", fmt.Errorf("unable to read history table %s: %w", table, err)
+		}
+		projects = append(projects, historyProject)
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", fmt.Errorf("unable to read history table %s: %w", table, err)
+	}
+
+	if len(projects) > 1 {
+		return "", fmt.Errorf("history table %s contains projects %s; choose one with --project",
+			table, strings.Join(projects, ", "))
+	}
+
+	if len(projects) == 0 {
+		return "", nil
+	}
+
+	return projects[0], nil
+}
+
+// ImportHistory reads the history table of another migration tool (one of "flyway", "golang-migrate"
+// or "sqitch") and records the corresponding migrations of the root package as already applied.
+// If table is empty, the tool's default history table is used. Entries in the history table which
+// can't be mapped to a migration are reported, but are not an error.
+//
+// A sqitch history table can contain the changes of several projects, so only the changes of the
+// given sqitch project are imported. If project is empty, the table must contain a single project.
+// The project is only used with sqitch.
+func (p *Project) ImportHistory(dsn string, toolName string, table string, project string) error {
+	tool, ok := historyTools[toolName]
+	if !ok {
+		return fmt.Errorf("unknown migration tool: %s", toolName)
+	}
+
+	if project != "" && tool.projectColumn == "" {
+		return fmt.Errorf("%s history doesn't have projects", toolName)
+	}
+
+	if table == "" {
+		table = tool.table
+	}
+
+	if !historyTablePattern.MatchString(table) {
+		return fmt.Errorf("invalid history table name: %s", table)
+	}
+
+	if p.Root == nil {
+		return fmt.Errorf("no package to import history into")
+	}
+
+	if err := p.Parse(); err != nil {
+		return err
+	}
+
+	return p.updatePgpkg(dsn, func(tx *PkgTx) error {
+		if toolName == "golang-migrate" {
+			var dirty bool
+			if err := tx.QueryRow(fmt.Sprintf("select coalesce(bool_or(dirty), false) from %s", table)).Scan(&dirty); err != nil {
+				return fmt.Errorf("unable to read history table %s: %w", table, err)
+			}
+
+			if dirty {
+				return fmt.Errorf("golang-migrate history in %s is dirty; fix the database before importing", table)
+			}
+		}
+
+		var args []any
+		if tool.projectColumn != "" {
+			historyProject, err := findHistoryProject(tx, tool, table, project)
+			if err != nil {
+				return err
+			}
+			args = append(args, historyProject)
+		}
+
+		entries, err := readHistory(tx, tool, table, args...)
+		if err != nil {
+			return err
+		}
+
+		applied, unmatched := mapHistory(entries, p.Root.Schema.migrationIndex, p.Root.config.HistoryMap, tool.linear)
+
+		for _, name := range applied {
+			if _, err := tx.Exec("insert into pgpkg.migration (pkg, path) values ($1, $2) on conflict do nothing",
+				p.Root.Name, name); err != nil {
+				return fmt.Errorf("unable to save migration state: %w", err)
+			}
+		}
+
+		for _, entry := range unmatched {
+			Stderr.Printf("warning: %s migration %s does not match any migration in %s\n", toolName, entry, p.Root.Name)
+		}
+
+		Stdout.Printf("%s: imported %d migration(s) from %s; %d unmatched\n", p.Root.Name, len(applied), table, len(unmatched))
+		return nil
+	})
+}
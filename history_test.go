@@ -0,0 +1,52 @@
+package pgpkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapHistory(t *testing.T) {
+	migrations := []string{
+		"schema/0001_account.sql",
+		"schema/V1_2__ledger.sql",
+		"schema/entry.sql",
+		"schema/0042_backfill.sql",
+		"schema/0043_index.sql",
+	}
+
+	historyMap := map[string]string{
+		"add_entries": "schema/entry.sql",
+	}
+
+	entries := []historyEntry{
+		{version: "1"},                         // version prefix
+		{version: "1.2", name: "V1_2__x.sql"},  // version prefix, despite a different filename
+		{name: "add_entries.sql"},              // not mapped; HistoryMap uses the change name
+		{version: "", name: "add_entries"},     // HistoryMap
+		{version: "99", name: "V99__gone.sql"}, // unmatched
+	}
+
+	applied, unmatched := mapHistory(entries, migrations, historyMap, false)
+
+	if want := []string{"0001_account.sql", "V1_2__ledger.sql", "entry.sql"}; !reflect.DeepEqual(applied, want) {
+		t.Fatalf("applied: got %v, want %v", applied, want)
+	}
+
+	if len(unmatched) != 2 || unmatched[0].name != "add_entries.sql" || unmatched[1].version != "99" {
+		t.Fatalf("unexpected unmatched entries: %v", unmatched)
+	}
+}
+
+func TestMapLinearHistory(t *testing.T) {
+	migrations := []string{"0001_account.sql", "0002_ledger.sql", "0042_backfill.sql", "0043_index.sql"}
+
+	applied, unmatched := mapHistory([]historyEntry{{version: "42"}}, migrations, nil, true)
+
+	if want := []string{"0001_account.sql", "0002_ledger.sql", "0042_backfill.sql"}; !reflect.DeepEqual(applied, want) {
+		t.Fatalf("applied: got %v, want %v", applied, want)
+	}
+
+	if len(unmatched) != 0 {
+		t.Fatalf("unexpected unmatched entries: %v", unmatched)
+	}
+}
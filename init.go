@@ -0,0 +1,224 @@
+package pgpkg
+
+// InitPackage creates the skeleton of a new package, which can be deployed straight away.
+// It contains a first migration, an example function and a test for it.
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var initSimpleIdentPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+var initSchemaCharPattern = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Quote an identifier, unless it doesn't need quoting.
+func initQuote(ident string) string {
+	if initSimpleIdentPattern.MatchString(ident) {
+		return ident
+	}
+
+	return quote(ident)
+}
+
+const initMigration = `--
+-- The first migration for package %[1]s.
+-- The schema itself is created by pgpkg.
+--
+create table %[2]s.greeting (
+    greeting_id integer generated always as identity primary key,
+    message text not null
+);
+`
+
+const initFunction = `--
+-- Functions, views and triggers are managed by pgpkg. Edit them in place;
+-- they are replaced whenever the package is deployed.
+--
+create or replace function %[2]s.hello(_name text) returns text language sql as $$
+    select 'Hello, ' || _name;
+$$;
+`
+
+const initTest = `--
+-- Functions whose names end in _test are run as tests whenever the package is deployed.
+--
+create or replace function %[2]s.hello_test() returns void language plpgsql as $$
+    begin
+        perform %[2]s.hello('world') =? 'Hello, world';
+    end;
+$$;
+`
+
+const initMain = `package main
+
+import (
+	"embed"
+	"fmt"
+	"github.com/pgpkg/pgpkg"
+)
+
+//go:embed pgpkg.toml *.sql schema
+var pkgFS embed.FS
+
+func main() {
+	var err error
+
+	if err = pgpkg.ParseArgs("pgpkg"); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	p := pgpkg.NewProject()
+	if _, err = p.AddEmbeddedFS(pkgFS, ""); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	db, err := p.Open("")
+	if err != nil {
+		pgpkg.Exit(err)
+	}
+	defer db.Close()
+
+	var greeting string
+	if err = db.QueryRow(%[3]s, "world").Scan(&greeting); err != nil {
+		pgpkg.Exit(err)
+	}
+
+	fmt.Println(greeting)
+}
+`
+
+// A file created by InitPackage, relative to the package directory.
+type initFile struct {
+	path     string
+	contents string
+}
+
+// Write a new file, failing if the file already exists.
+func writeInitFile(dir string, filePath string, contents string) error {
+	fullPath := path.Join(dir, filePath)
+	if err := os.MkdirAll(path.Dir(fullPath), 0777); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", fullPath, err)
+	}
+
+	if _, err = f.WriteString(contents); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to write %s: %w", fullPath, err)
+	}
+
+	return f.Close()
+}
+
+// Add .pgpkg to the .gitignore file in dir, creating it if needed.
+func initGitIgnore(dir string) error {
+	gitIgnorePath := path.Join(dir, ".gitignore")
+	existing, err := os.ReadFile(gitIgnorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s: %w", gitIgnorePath, err)
+	}
+
+	for _, line := range strings.Split(string(existing), "\n") {
+		if line = strings.TrimSpace(line); line == ".pgpkg" || line == ".pgpkg/" || line == "/.pgpkg/" {
+			return nil
+		}
+	}
+
+	contents := string(existing)
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		contents = contents + "\n"
+	}
+
+	if err = os.WriteFile(gitIgnorePath, []byte(contents+".pgpkg/\n"), 0666); err != nil {
+		return fmt.Errorf("unable to write %s: %w", gitIgnorePath, err)
+	}
+
+	return nil
+}
+
+// InitPackage creates a new package in dir, which is created if needed. If pkgName is empty, the name
+// of the directory is used. If schema is empty, it's derived from the last element of the package name.
+// If withGo is set, a main.go is also created, which embeds the package and deploys it.
+func InitPackage(dir string, pkgName string, schema string, withGo bool) error {
+	if _, err := os.Stat(path.Join(dir, "pgpkg.toml")); err == nil {
+		return fmt.Errorf("%s already contains a package", dir)
+	}
+
+	if pkgName == "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("unable to find package directory: %w", err)
+		}
+		pkgName = filepath.Base(absDir)
+	}
+
+	if err := CheckPackageName(pkgName); err != nil {
+		return err
+	}
+
+	if schema == "" {
+		schema = strings.Trim(initSchemaCharPattern.ReplaceAllString(strings.ToLower(path.Base(pkgName)), "_"), "_")
+	}
+
+	if !schemaPattern.MatchString(schema) || schema == PGKSchemaName {
+		return fmt.Errorf("illegal schema name: %s", schema)
+	}
+
+	const migrationPath = "schema/0001_init.sql"
+	config := &configType{
+		Package:    pkgName,
+		Schemas:    []string{schema},
+		Migrations: []string{migrationPath},
+	}
+
+	var configText strings.Builder
+	if err := config.writeConfig(&configText); err != nil {
+		return fmt.Errorf("unable to write config file: %w", err)
+	}
+
+	schemaIdent := initQuote(schema)
+	helloQuery := strconv.Quote("select " + schemaIdent + ".hello($1)")
+	expand := func(template string) string {
+		return fmt.Sprintf(template, pkgName, schemaIdent, helloQuery)
+	}
+
+	// The files are written in order, with pgpkg.toml last, so that the directory only contains
+	// a package once every file has been written.
+	files := []initFile{
+		{migrationPath, expand(initMigration)},
+		{"hello.sql", expand(initFunction)},
+		{"hello_test.sql", expand(initTest)},
+	}
+
+	if withGo {
+		files = append(files, initFile{"main.go", expand(initMain)})
+	}
+
+	files = append(files, initFile{"pgpkg.toml", configText.String()})
+
+	for _, file := range files {
+		if _, err := os.Stat(path.Join(dir, file.path)); err == nil {
+			return fmt.Errorf("%s already exists", path.Join(dir, file.path))
+		}
+	}
+
+	// If a file can't be written, the files written so far are removed.
+	for i, file := range files {
+		if err := writeInitFile(dir, file.path, file.contents); err != nil {
+			for _, written := range files[:i] {
+				_ = os.Remove(path.Join(dir, written.path))
+			}
+			return err
+		}
+	}
+
+	return initGitIgnore(dir)
+}
@@ -0,0 +1,62 @@
+package pgpkg
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestInitPackage(t *testing.T) {
+	dir := t.TempDir()
+	if err := InitPackage(dir, "github.com/acme/general-ledger", "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewProjectFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	if schemaNames := p.Root.SchemaNames; len(schemaNames) != 1 || schemaNames[0] != "general_ledger" {
+		t.Errorf("unexpected schema names %v", schemaNames)
+	}
+
+	if _, err = parser.ParseFile(token.NewFileSet(), path.Join(dir, "main.go"), nil, 0); err != nil {
+		t.Errorf("main.go: %v", err)
+	}
+
+	if err = InitPackage(dir, "", "", false); err == nil {
+		t.Error("expected an error when the package already exists")
+	}
+}
+
+func TestInitPackageExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "hello.sql"), []byte("-- my own file\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitPackage(dir, "github.com/acme/hello", "", false); err == nil {
+		t.Fatal("expected an error when a file already exists")
+	}
+
+	// Nothing else was written.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "hello.sql" {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("unexpected files after a failed init: %v", names)
+	}
+}
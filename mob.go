@@ -33,7 +33,7 @@ func (m *MOB) Parse() error {
 	definitions := make(map[string]*Statement)
 
 	for _, u := range m.Units {
-		if Options.Verbose {
+		if m.Package.options().Verbose {
 			Verbose.Println("parsing MOB", u.Location())
 		}
 		if err := u.Parse(); err != nil {
@@ -109,6 +109,7 @@ func execAll(tx *PkgTx, state *stmtApplyState) error {
 type stmtStoredState struct {
 	objType string
 	objName string
+	defHash string // hash of the definition when it was deployed; empty if unknown
 }
 
 func (s *stmtStoredState) getDropStatement() string {
@@ -129,8 +130,9 @@ func (s *stmtStoredState) getDropStatement() string {
 // loadState returns the state objects in reverse order from how they were created.
 // this should make dumping objects faster.
 func (m *MOB) loadState(tx *PkgTx) ([]*stmtStoredState, error) {
-	rows, err := tx.Query("select obj_type, obj_name from pgpkg.managed_object where pkg=$1 order by seq desc",
-		m.Package.Name)
+	// def_hash is read using to_jsonb() so that older pgpkg schemas can still be verified.
+	rows, err := tx.Query("select obj_type, obj_name, coalesce(to_jsonb(o)->>'def_hash', '') "+
+		"from pgpkg.managed_object o where pkg=$1 order by seq desc", m.Package.Name)
 	if err != nil {
 		return nil, PKGErrorf(m, err, "unable to load MOB state")
 	}
@@ -139,7 +141,7 @@ func (m *MOB) loadState(tx *PkgTx) ([]*stmtStoredState, error) {
 
 	for rows.Next() {
 		state := &stmtStoredState{}
-		if err := rows.Scan(&state.objType, &state.objName); err != nil {
+		if err := rows.Scan(&state.objType, &state.objName, &state.defHash); err != nil {
 			return nil, PKGErrorf(m, err, "error during load of MOB state")
 		}
 		stateList = append(stateList, state)
@@ -219,16 +221,29 @@ func (m *MOB) updateState(tx *PkgTx) error {
 		return fmt.Errorf("unable to remove existing state: %w", err)
 	}
 
+	objects := make([]*ManagedObject, len(m.state.success))
 	for seq, stmt := range m.state.success {
-		obj, err := stmt.GetManagedObject()
-		if err != nil {
+		if objects[seq], err = stmt.GetManagedObject(); err != nil {
 			return err
 		}
+	}
 
+	defHashes, err := readDefinitionHashes(tx, objects)
+	if err != nil {
+		return err
+	}
+
+	for seq, stmt := range m.state.success {
+		obj := objects[seq]
 		if obj != nil {
+			var defHash *string
+			if hash, ok := defHashes[obj]; ok {
+				defHash = &hash
+			}
+
 			_, err = tx.Exec(
-				"insert into pgpkg.managed_object (pkg, seq, obj_type, obj_name) "+
-					"values ($1, $2, $3, $4)", m.Bundle.Package.Name, seq, obj.ObjectType, obj.ObjectName)
+				"insert into pgpkg.managed_object (pkg, seq, obj_type, obj_name, src_hash, def_hash) "+
+					"values ($1, $2, $3, $4, $5, $6)", m.Bundle.Package.Name, seq, obj.ObjectType, obj.ObjectName, stmt.sourceHash(), defHash)
 			if err != nil {
 				return fmt.Errorf("unable to update package state: %w", err)
 			}
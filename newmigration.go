@@ -0,0 +1,146 @@
+package pgpkg
+
+// New migrations are named with a prefix, followed by a description, so that their names are
+// unique and sort in the order they were created. The prefix is either the next number in
+// sequence (e.g. "0004_add_ledger.sql"), or a UTC timestamp (e.g. "20240131093000_add_ledger.sql"),
+// which avoids conflicts when several people add migrations at the same time.
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	migrationPrefixSequence  = "sequence"
+	migrationPrefixTimestamp = "timestamp"
+)
+
+var migrationSequencePattern = regexp.MustCompile(`^([0-9]+)[_-]`)
+var migrationDescriptionPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Convert a description into a form suitable for use in a filename.
+func migrationSlug(description string) string {
+	return strings.Trim(migrationDescriptionPattern.ReplaceAllString(strings.ToLower(description), "_"), "_")
+}
+
+// Return the prefix for the next migration in a sequence of migrations. The prefix is one more than
+// the highest numbered migration, and has at least as many digits (and at least four).
+func nextMigrationSequence(migrations []string) string {
+	next, width := 1, 4
+	for _, migrationPath := range migrations {
+		match := migrationSequencePattern.FindStringSubmatch(path.Base(migrationPath))
+		if match == nil {
+			continue
+		}
+
+		if n, err := strconv.Atoi(match[1]); err == nil && n >= next {
+			next = n + 1
+		}
+
+		if len(match[1]) > width {
+			width = len(match[1])
+		}
+	}
+
+	return fmt.Sprintf("%0*d", width, next)
+}
+
+// NewMigration creates an empty migration script with the given description, adds it to the end
+// of the package's Migrations list and updates pgpkg.toml. Returns the path of the new migration.
+func (p *Package) NewMigration(description string) (string, error) {
+	if p.config.Migrations == nil {
+		if legacyDir, _ := p.findMigrationCatalog(); legacyDir != "" {
+			return "", fmt.Errorf("package %s uses %s/%s; convert it to the Migrations clause first",
+				p.Name, legacyDir, migrationFilename)
+		}
+	}
+
+	slug := migrationSlug(description)
+	if slug == "" {
+		return "", fmt.Errorf("migration description is required")
+	}
+
+	var prefix string
+	switch p.config.MigrationPrefix {
+	case migrationPrefixTimestamp:
+		prefix = time.Now().UTC().Format("20060102150405")
+	default:
+		prefix = nextMigrationSequence(p.config.Migrations)
+	}
+
+	return p.CreateMigration(prefix+"_"+slug, "--\n-- "+description+"\n--\n")
+}
+
+// Find the directory containing the legacy @migration.pgpkg file, if any.
+func (p *Package) findMigrationCatalog() (string, error) {
+	var migrationDir string
+
+	err := fs.WalkDir(p.Source, ".", func(unitPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && unitPath != "." && d.Name()[0] == '.' {
+			return fs.SkipDir
+		}
+
+		if !d.IsDir() && d.Name() == migrationFilename {
+			migrationDir = path.Dir(unitPath)
+			return fs.SkipAll
+		}
+
+		return nil
+	})
+
+	return migrationDir, err
+}
+
+// ConvertMigrationCatalog converts a package that lists its migrations in the deprecated
+// @migration.pgpkg file to use the Migrations clause of pgpkg.toml instead. The config file
+// is updated, and @migration.pgpkg is removed. Returns the number of migrations converted.
+func (p *Package) ConvertMigrationCatalog() (int, error) {
+	dirFS, ok := p.Source.(*DirSource)
+	if !ok {
+		return 0, fmt.Errorf("package was not loaded from filesystem")
+	}
+
+	if len(p.config.Migrations) > 0 {
+		return 0, fmt.Errorf("package %s already uses the Migrations clause", p.Name)
+	}
+
+	migrationDir, err := p.findMigrationCatalog()
+	if err != nil {
+		return 0, fmt.Errorf("unable to find %s: %w", migrationFilename, err)
+	}
+
+	if migrationDir == "" {
+		return 0, fmt.Errorf("package %s does not have a %s file", p.Name, migrationFilename)
+	}
+
+	migrationPaths, err := NewSchema(p).loadCatalog(migrationDir)
+	if err != nil {
+		return 0, fmt.Errorf("unable to load migration catalog: %w", err)
+	}
+
+	for _, migrationPath := range migrationPaths {
+		if err = p.AddMigration(path.Join(migrationDir, migrationPath)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = p.WriteConfig(); err != nil {
+		return 0, err
+	}
+
+	if err = os.Remove(path.Join(dirFS.Path(), migrationDir, migrationFilename)); err != nil {
+		return 0, fmt.Errorf("unable to remove %s: %w", migrationFilename, err)
+	}
+
+	return len(migrationPaths), nil
+}
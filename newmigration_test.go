@@ -0,0 +1,28 @@
+package pgpkg
+
+import "testing"
+
+func TestNextMigrationSequence(t *testing.T) {
+	tests := []struct {
+		migrations []string
+		want       string
+	}{
+		{nil, "0001"},
+		{[]string{"schema/account.sql"}, "0001"},
+		{[]string{"schema/0001_account.sql", "schema/0002_ledger.sql"}, "0003"},
+		{[]string{"0009-x.sql", "legacy.sql"}, "0010"},
+		{[]string{"000041_x.sql"}, "000042"},
+	}
+
+	for _, test := range tests {
+		if got := nextMigrationSequence(test.migrations); got != test.want {
+			t.Errorf("nextMigrationSequence(%v) = %s, want %s", test.migrations, got, test.want)
+		}
+	}
+}
+
+func TestMigrationSlug(t *testing.T) {
+	if got := migrationSlug("  Add ledger (v2)!"); got != "add_ledger_v2" {
+		t.Errorf("migrationSlug() = %s, want add_ledger_v2", got)
+	}
+}
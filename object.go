@@ -68,6 +68,43 @@ func (s *Statement) getFunctionObject() (*ManagedObject, error) {
 	}, nil
 }
 
+// functionSignature returns the qualified name and argument types of a function, in a form
+// that can be used with regprocedure. Unlike the object name, it doesn't include argument names.
+func (s *Statement) functionSignature() string {
+	return functionSignature(s.Tree.Stmt.GetCreateFunctionStmt())
+}
+
+func functionSignature(createFunctionStmt *pg_query.CreateFunctionStmt) string {
+	var argTypes []string
+	for _, arg := range createFunctionStmt.Parameters {
+		fp := arg.GetFunctionParameter()
+		if fp.Mode == pg_query.FunctionParameterMode_FUNC_PARAM_IN ||
+			fp.Mode == pg_query.FunctionParameterMode_FUNC_PARAM_INOUT ||
+			fp.Mode == pg_query.FunctionParameterMode_FUNC_PARAM_DEFAULT {
+			argTypes = append(argTypes, getParamType(fp))
+		}
+	}
+
+	return fmt.Sprintf("%s.%s(%s)", quote(AsString(createFunctionStmt.Funcname[0])),
+		quote(AsString(createFunctionStmt.Funcname[1])), strings.Join(argTypes, ","))
+}
+
+// managedFunctionSignature returns the signature of a managed function, given the object name
+// recorded for it (see getFunctionObject). The name is parsed in the same way as the function itself.
+func managedFunctionSignature(objName string) (string, error) {
+	result, err := pg_query.Parse("create function " + objName + " returns void language sql as ''")
+	if err != nil {
+		return "", fmt.Errorf("unable to parse function name %s: %w", objName, err)
+	}
+
+	createFunctionStmt := result.Stmts[0].Stmt.GetCreateFunctionStmt()
+	if len(createFunctionStmt.Funcname) != 2 {
+		return "", fmt.Errorf("function name %s is not qualified", objName)
+	}
+
+	return functionSignature(createFunctionStmt), nil
+}
+
 func (s *Statement) getCastObject() (*ManagedObject, error) {
 	createCastStmt := s.Tree.Stmt.GetCreateCastStmt()
 	return &ManagedObject{
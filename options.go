@@ -4,22 +4,43 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// Options is a list of global options used by pgpkg.
-
-var Options struct {
-	Verbose         bool           // print lots of stuff
-	Summary         bool           // print a summary of the installation
-	DryRun          bool           // rollback after installation (default)
-	ShowTests       bool           // Show the result of each SQL test that was run.
-	SortTests       bool           // Execute tests in a well defined order
-	ShowSkipped     bool           // Show skipped tests
-	SkipTests       bool           // Don't run the tests. Useful when fixing them!
-	KeepTestScripts bool           // Keep the test functions, useful for Go unit testing, use only with temporary databases.
-	IncludePattern  *regexp.Regexp // Pattern to use for running tests
-	ExcludePattern  *regexp.Regexp // Pattern to use for running tests
-	ForceRole       string         // Use this role instead of package roles
+// OptionSet is a set of options which control how pgpkg works.
+type OptionSet struct {
+	Verbose          bool           // print lots of stuff
+	Summary          bool           // print a summary of the installation
+	DryRun           bool           // rollback after installation (default)
+	ShowTests        bool           // Show the result of each SQL test that was run.
+	SortTests        bool           // Execute tests in a well defined order
+	TestOrder        string         // Order in which to run tests: "random", "sorted" or "declared"
+	TestSeed         int64          // Seed used to shuffle tests in random order; 0 means choose one
+	ShowSkipped      bool           // Show skipped tests
+	SkipTests        bool           // Don't run the tests. Useful when fixing them!
+	FailFast         bool           // Stop running tests after the first failure
+	KeepTestScripts  bool           // Keep the test functions, useful for Go unit testing, use only with temporary databases.
+	IncludePattern   *regexp.Regexp // Pattern to use for running tests
+	ExcludePattern   *regexp.Regexp // Pattern to use for running tests
+	ForceRole        string         // Use this role instead of package roles
+	IgnoreBaseline   bool           // Replay all migrations, even for fresh installs of packages with a baseline
+	NoCacheDB        bool           // Build temporary databases from scratch, instead of copying a template
+	KeepDBOnFailure  bool           // Keep the temporary database of pgpkg test if a test fails
+	CommitFailedTest bool           // When keeping the database, also keep the effects of the failed test
+	TestReports      []testReport   // Write the test results to these reports
+}
+
+// Options is the global set of options used by pgpkg, which are set by ParseArgs.
+// Each project uses the global options, unless it has its own; see Project.Options.
+var Options OptionSet
+
+// Copy returns a copy of the options, which can be changed without affecting the original.
+func (o *OptionSet) Copy() *OptionSet {
+	c := *o
+	c.TestReports = append([]testReport(nil), o.TestReports...)
+	return &c
 }
 
 func showHelp() {
@@ -46,10 +67,23 @@ Transactions and Testing Options
 --sort-tests
     Tests normally run in random order. This option runs tests in a fixed order,
 	so that the test run is repeatable. This can be helpful during large refactors.
+	It's the same as --test-order=sorted.
+
+--test-order=[random|sorted|declared]
+    Run tests in random order (the default), sorted by name, or in the order they are declared,
+    file by file. With "declared", before-functions and other fixtures also run in declaration order.
+
+--test-seed=[seed]
+    Shuffle tests using the given seed, so that a random order can be repeated. The seed is
+    printed whenever tests are run in random order.
 
 --skip-tests
     Do not run any tests before committing the changes. You should take care with this option.
 
+--fail-fast
+    Stop running the tests as soon as one of them fails. By default, every test is run,
+    and all the failures are reported.
+
 --keep-test-scripts
     Do not purge the test scripts when finished. Useful for integrating with Go unit tests.
 	WARNING: Migrations performed using -keep-test-scripts cannot be upgraded later.
@@ -64,6 +98,28 @@ Transactions and Testing Options
 --show-skipped
     Logs all tests, even if they are skipped. By default, only tests that run are logged.
 
+--test-report=junit:[path]
+--test-report=tap[:path]
+    Write the result of every test to a JUnit XML or TAP report, for use by CI systems.
+    TAP reports are written to stdout if no path is given. This option can be repeated.
+
+Migration Options
+
+--ignore-baseline
+    Don't use the Baseline script when installing a package for the first time; replay
+    every migration instead.
+
+--no-cache-db
+    pgpkg test and pgpkg repl normally create their temporary database as a copy of a template
+    database, which is only rebuilt when the project changes. This option builds the temporary
+    database from scratch instead. Use "pgpkg cache clean-db" to remove template databases.
+
+--keep-db-on-failure[=commit]
+    If a test fails, pgpkg test keeps its temporary database, in the state just before the failed
+    test was run, and prints its name. With "commit", the effects of the failed test (and its
+    setup functions) are also kept, up to the first error. Use "pgpkg cleanup" to remove the
+    database when you're done.
+
 Logging Options
 
 pgpkg normally runs silently (unless your SQL code includes raise notice messages). These options tell pgpkg
@@ -126,12 +182,28 @@ func ParseArgs(prefix string) error {
 		case "sort-tests":
 			Options.SortTests = true
 
+		case "test-order":
+			if switchValue != testOrderRandom && switchValue != testOrderSorted && switchValue != testOrderDeclared {
+				return fmt.Errorf("unknown test order %s; use random, sorted or declared", switchValue)
+			}
+			Options.TestOrder = switchValue
+
+		case "test-seed":
+			seed, err := strconv.ParseInt(switchValue, 10, 64)
+			if err != nil || seed == 0 {
+				return fmt.Errorf("invalid test seed %s", switchValue)
+			}
+			Options.TestSeed = seed
+
 		case "show-skipped":
 			Options.ShowSkipped = true
 
 		case "skip-tests":
 			Options.SkipTests = true
 
+		case "fail-fast":
+			Options.FailFast = true
+
 		case "keep-test-scripts":
 			Options.KeepTestScripts = true
 
@@ -152,6 +224,26 @@ func ParseArgs(prefix string) error {
 		case "force-role":
 			Options.ForceRole = switchValue
 
+		case "ignore-baseline":
+			Options.IgnoreBaseline = true
+
+		case "no-cache-db":
+			Options.NoCacheDB = true
+
+		case "keep-db-on-failure":
+			if switchValue != "" && switchValue != "commit" {
+				return fmt.Errorf("unknown value for --keep-db-on-failure: %s; use commit, or no value", switchValue)
+			}
+			Options.KeepDBOnFailure = true
+			Options.CommitFailedTest = switchValue == "commit"
+
+		case "test-report":
+			report, err := parseTestReport(switchValue)
+			if err != nil {
+				return err
+			}
+			Options.TestReports = append(Options.TestReports, report)
+
 		case "help":
 			showHelp()
 			return ErrUserRequest
@@ -168,3 +260,37 @@ func ParseArgs(prefix string) error {
 	os.Args = parsedArgs
 	return nil
 }
+
+const (
+	testOrderRandom   = "random"
+	testOrderSorted   = "sorted"
+	testOrderDeclared = "declared"
+)
+
+// Get the order in which tests are run.
+func (o *OptionSet) testOrder() string {
+	if o.TestOrder != "" {
+		return o.TestOrder
+	}
+
+	if o.SortTests {
+		return testOrderSorted
+	}
+
+	return testOrderRandom
+}
+
+var testSeedLock sync.Mutex
+
+// Get the seed used to shuffle tests. If no seed was given, one is chosen and then used
+// for the rest of the run, so that every package is shuffled with the same seed.
+func (o *OptionSet) testSeed() int64 {
+	testSeedLock.Lock()
+	defer testSeedLock.Unlock()
+
+	if o.TestSeed == 0 {
+		o.TestSeed = time.Now().UnixNano()
+	}
+
+	return o.TestSeed
+}
@@ -1,6 +1,7 @@
 package pgpkg
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -17,8 +18,8 @@ const migrationFilename = "@migration.pgpkg"
 // keeps track of and maintains the objects declared in the
 // package, but doesn't touch anything else.
 //
-// Packages are divided into three bundles, called schema,
-// MOB and tests. Each bundle operates in a unique way.
+// Packages are divided into four bundles, called schema,
+// MOB, tests and data. Each bundle operates in a unique way.
 //
 // The database structure is represented by a list of upgrade
 // files, which are always executed in order. These files can contain
@@ -32,6 +33,9 @@ const migrationFilename = "@migration.pgpkg"
 // Tests are files containing SQL functions, that are executed in order. Tests
 // that produce exceptions cause the upgrade to be rolled back.
 //
+// Data files are CSV files containing reference data, which are loaded into
+// tables after the migrations have been run.
+//
 // The structure of a Package is:
 //
 //    Package -> Bundles (structure, app, tests) -> Units (files) -> Statements
@@ -54,12 +58,20 @@ type Package struct {
 	Schema *Schema
 	MOB    *MOB
 	Tests  *Tests
+	Data   *Data
 
 	IsDependency    bool // This package was loaded from .pgpkg cache
 	bootstrapSchema bool // migrate without checking migration table. Allows pgpkg to bootstrap itself.
 	config          *configType
+
+	migrationFuncs map[string]MigrationFunc // Go migrations registered with RegisterMigration, by name
 }
 
+// MigrationFunc is a migration step written in Go, for migrations that can't be written in SQL.
+// It is run in the package's migration transaction, using the package's role. The context is the
+// one passed to Project.OpenContext or Project.MigrateContext, and is also used by tx.
+type MigrationFunc func(ctx context.Context, tx *PkgTx) error
+
 func (p *Package) newBundle() *Bundle {
 	return &Bundle{
 		Path:    "",
@@ -68,6 +80,15 @@ func (p *Package) newBundle() *Bundle {
 	}
 }
 
+// Get the options used by the package's project.
+func (p *Package) options() *OptionSet {
+	if p.Project != nil {
+		return p.Project.options()
+	}
+
+	return &Options
+}
+
 func (p *Package) setRole(tx *PkgTx) {
 	_, err := tx.Exec(fmt.Sprintf("set role \"%s\"", Sanitize(rolePattern, p.RoleName)))
 	if err != nil {
@@ -228,7 +249,7 @@ func (p *Package) Apply(tx *PkgTx) error {
 		}
 
 	} else {
-		if Options.Verbose {
+		if p.options().Verbose {
 			fmt.Fprintf(os.Stderr, "note: %s: no MOBs defined\n", p.Name)
 		}
 	}
@@ -243,7 +264,7 @@ func (p *Package) Apply(tx *PkgTx) error {
 		return err
 	}
 
-	if p.Schema != nil && p.Schema.HasUnits() {
+	if p.Schema != nil && p.Schema.hasMigrations() {
 		// Load the migration state outside the schema role.
 		if err = p.Schema.loadMigrationState(tx); err != nil {
 			return err
@@ -262,11 +283,19 @@ func (p *Package) Apply(tx *PkgTx) error {
 			return err
 		}
 	} else {
-		if Options.Verbose {
+		if p.options().Verbose {
 			fmt.Fprintf(os.Stderr, "note: %s: no schema defined\n", p.Name)
 		}
 	}
 
+	if p.Data != nil && p.Data.HasUnits() {
+		p.setRole(tx)
+		if err = p.Data.Apply(tx); err != nil {
+			return err
+		}
+		p.resetRole(tx)
+	}
+
 	if p.MOB != nil && p.MOB.HasUnits() {
 		p.setRole(tx)
 		if err = p.MOB.Apply(tx); err != nil {
@@ -283,7 +312,7 @@ func (p *Package) Apply(tx *PkgTx) error {
 		return err
 	}
 
-	if p.Tests != nil && p.Tests.HasUnits() && !Options.SkipTests {
+	if p.Tests != nil && p.Tests.HasUnits() && !p.options().SkipTests {
 		p.setRole(tx)
 		if err := p.Tests.Run(tx); err != nil {
 			return err
@@ -291,7 +320,7 @@ func (p *Package) Apply(tx *PkgTx) error {
 		p.resetRole(tx)
 	}
 
-	if Options.Verbose || Options.Summary {
+	if p.options().Verbose || p.options().Summary {
 		Verbose.Printf("%s: installed %d function(s), %d view(s) and %d trigger(s). %d migration(s) needed. %d test(s) run\n",
 			p.Name, p.StatFuncCount, p.StatViewCount, p.StatTriggerCount, p.StatMigrationCount, p.StatTestCount)
 	}
@@ -323,8 +352,8 @@ func (p *Package) parseConfig(tomlPath string) error {
 	p.SchemaNames = SanitizeSlice(schemaPattern, config.Schemas)
 	p.config = config
 
-	if Options.ForceRole != "" {
-		p.RoleName = Sanitize(rolePattern, Options.ForceRole)
+	if p.options().ForceRole != "" {
+		p.RoleName = Sanitize(rolePattern, p.options().ForceRole)
 	} else {
 		p.RoleName = Sanitize(rolePattern, "$"+p.Name)
 	}
@@ -356,6 +385,11 @@ func (p *Package) addUnit(unitPath string, d fs.DirEntry, err error) error {
 	}
 
 	if d.IsDir() {
+		// Declarative table definitions are only used to generate migrations.
+		if p.config.Tables != "" && unitPath == path.Clean(p.config.Tables) {
+			return fs.SkipDir
+		}
+
 		// If this is a directory, and it contains migrations, then
 		// process it with a separate walk().
 		if _, err = fs.Stat(p.Source, path.Join(unitPath, migrationFilename)); err == nil {
@@ -371,6 +405,11 @@ func (p *Package) addUnit(unitPath string, d fs.DirEntry, err error) error {
 		return nil
 	}
 
+	// Data files are listed explicitly in the config, so they are also ignored.
+	if _, ok := p.Data.getUnit(unitPath); ok {
+		return nil
+	}
+
 	if strings.HasSuffix(name, "_test.sql") {
 		return p.Tests.addUnit(unitPath)
 	}
@@ -411,6 +450,7 @@ func (p *Package) readSchema() error {
 	p.Schema = NewSchema(p)
 	p.MOB = &MOB{Bundle: p.newBundle()}
 	p.Tests = &Tests{Bundle: p.newBundle()}
+	p.Data = &Data{Bundle: p.newBundle()}
 
 	// if the package config explicitly lists migrations, then you can't have a @migrations.pgpkg file.
 	if len(p.config.Migrations) > 0 {
@@ -419,15 +459,69 @@ func (p *Package) readSchema() error {
 		}
 	}
 
+	if p.config.Baseline != "" {
+		if err := p.Schema.loadBaseline(p.config.Baseline, p.config.BaselineThrough); err != nil {
+			return fmt.Errorf("unable to load schema baseline: %w", err)
+		}
+	}
+
+	if len(p.config.Repeatable) > 0 {
+		if err := p.Schema.loadRepeatables(p.config.Repeatable); err != nil {
+			return fmt.Errorf("unable to load repeatable migrations: %w", err)
+		}
+	}
+
+	for _, data := range p.config.Data {
+		if err := p.Data.addDataFile(data); err != nil {
+			return fmt.Errorf("unable to load data files: %w", err)
+		}
+	}
+
 	// Only walk the directory in which the toml file was found, rather than
 	// the entire filesystem provided in pkgFS.
 	if err := fs.WalkDir(p.Source, ".", p.addUnit); err != nil {
 		return fmt.Errorf("unable to read schema for package %s: %w", p.Name, err)
 	}
 
+	// Catch Go migrations that will never be run.
+	for name := range p.migrationFuncs {
+		if !p.Schema.hasMigration(name) {
+			return fmt.Errorf("Go migration %s is not listed in the migrations for package %s", name, p.Name)
+		}
+	}
+
 	return nil
 }
 
+// RegisterMigration registers a Go function as a named migration step. The name must appear
+// in the package's Migrations list, where it is run in order with the SQL migrations, and
+// tracked in the same way. Go migrations must be registered before the project is opened.
+func (p *Package) RegisterMigration(name string, fn MigrationFunc) error {
+	if name == "" || path.Base(name) != name {
+		return fmt.Errorf("invalid Go migration name '%s'", name)
+	}
+
+	if p.Schema != nil {
+		return fmt.Errorf("Go migration %s must be registered before the project is opened", name)
+	}
+
+	if _, ok := p.migrationFuncs[name]; ok {
+		return fmt.Errorf("duplicate Go migration %s", name)
+	}
+
+	if p.migrationFuncs == nil {
+		p.migrationFuncs = make(map[string]MigrationFunc)
+	}
+
+	p.migrationFuncs[name] = fn
+	return nil
+}
+
+// Baseline returns the path of the package's baseline script, or "" if it doesn't have one.
+func (p *Package) Baseline() string {
+	return p.config.Baseline
+}
+
 func (p *Package) isValidSchema(search string) bool {
 	for _, schema := range p.SchemaNames {
 		if schema == search {
@@ -457,6 +551,84 @@ func (p *Package) AddUses(pkg string) bool {
 	return true
 }
 
+// AddMigration adds the migration script at the given path to the end of the package's
+// Migrations list. Note that this does not update the config file; to do this, see WriteConfig.
+func (p *Package) AddMigration(migrationPath string) error {
+	migrationName := path.Base(migrationPath)
+	for _, existing := range p.config.Migrations {
+		if path.Base(existing) == migrationName {
+			return fmt.Errorf("duplicate migration name '%s' found in path %s", migrationName, existing)
+		}
+	}
+
+	p.config.Migrations = append(p.config.Migrations, migrationPath)
+	return nil
+}
+
+// MigrationDir returns the directory in which new migration scripts should be created.
+// This is the MigrationDir from pgpkg.toml if it's set; otherwise, it's the directory of the
+// most recent migration, or "schema" if there are no migrations yet.
+func (p *Package) MigrationDir() string {
+	if p.config.MigrationDir != "" {
+		return path.Clean(p.config.MigrationDir)
+	}
+
+	if n := len(p.config.Migrations); n > 0 {
+		return path.Dir(p.config.Migrations[n-1])
+	}
+
+	return "schema"
+}
+
+// CreateMigration writes a new migration script, with the given contents, into the package's
+// migration directory, adds it to the end of the Migrations list and updates pgpkg.toml.
+// The name is the filename of the migration; ".sql" is added if needed. Returns the path of the
+// new migration, relative to the package.
+func (p *Package) CreateMigration(name string, contents string) (string, error) {
+	dirFS, ok := p.Source.(*DirSource)
+	if !ok {
+		return "", fmt.Errorf("package was not loaded from filesystem")
+	}
+
+	if !strings.HasSuffix(name, ".sql") {
+		name = name + ".sql"
+	}
+
+	if path.Base(name) != name {
+		return "", fmt.Errorf("invalid migration name '%s'", name)
+	}
+
+	migrationPath := path.Join(p.MigrationDir(), name)
+	if err := p.AddMigration(migrationPath); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(path.Join(dirFS.Path(), p.MigrationDir()), 0755); err != nil {
+		return "", fmt.Errorf("unable to create migration directory: %w", err)
+	}
+
+	// Never overwrite an existing file.
+	f, err := os.OpenFile(path.Join(dirFS.Path(), migrationPath), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("unable to create migration: %w", err)
+	}
+
+	if _, err = f.WriteString(contents); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("unable to write migration %s: %w", migrationPath, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("unable to write migration %s: %w", migrationPath, err)
+	}
+
+	if err = p.WriteConfig(); err != nil {
+		return "", err
+	}
+
+	return migrationPath, nil
+}
+
 func (p *Package) WriteConfig() error {
 	// We can only write to this package if it came from a directory.
 	dirFS, ok := p.Source.(*DirSource)
@@ -511,4 +683,10 @@ func (p *Package) PrintInfo(w InfoWriter) {
 		w.Println("no tests")
 	}
 
+	if p.Data != nil {
+		p.Data.PrintInfo(w)
+	} else {
+		w.Println("no data")
+	}
+
 }
@@ -0,0 +1,6 @@
+--
+-- Repeatable migrations are run again whenever their contents change. The hash
+-- records the contents of the script when it was last run. It's null for regular
+-- migrations, which only ever run once.
+--
+alter table pgpkg.migration add column hash text;
@@ -0,0 +1,5 @@
+--
+-- Record a hash of the source of each managed object, so that we can tell
+-- which objects will be changed by a deployment (see pgpkg plan).
+--
+alter table pgpkg.managed_object add column src_hash text;
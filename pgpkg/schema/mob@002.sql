@@ -0,0 +1,6 @@
+--
+-- Record a hash of the definition of each managed object, as read from the
+-- catalog after it was created, so that we can tell if it has been changed
+-- outside of pgpkg (see pgpkg verify).
+--
+alter table pgpkg.managed_object add column def_hash text;
@@ -0,0 +1,156 @@
+// Package pgpkgtest helps to write Go tests for code which uses a pgpkg project.
+//
+// NewDB creates a temporary database for a single test, deploys the project into it,
+// and drops the database when the test completes:
+//
+//	func TestLedger(t *testing.T) {
+//		t.Parallel()
+//
+//		p, err := pgpkg.NewProjectFrom("../schema")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//
+//		db := pgpkgtest.NewDB(t, p)
+//		...
+//	}
+//
+// RunSQLTests runs the project's SQL tests as Go subtests, so that they can be selected with
+// go test -run, and reported by go test -json.
+//
+// The database server is given by the PGPKG_DSN environment variable, in addition to the
+// standard Postgres environment (PGHOST, PGUSER, ...).
+package pgpkgtest
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pgpkg/pgpkg"
+)
+
+// NewDB creates a temporary database, deploys the project into it, and returns a connection to
+// the database, ready for queries. The connection is closed and the database is dropped when the
+// test and its subtests complete. If the project can't be deployed, the test fails immediately.
+//
+// The project's SQL tests are run during deployment, and the test scripts are kept, so that
+// test functions can be called from Go.
+//
+// NewDB can be used by parallel tests, but each test needs its own project. The project is given
+// its own copy of the global options (if it doesn't already have options), so changing
+// pgpkg.Options doesn't affect tests that are already running.
+func NewDB(t testing.TB, p *pgpkg.Project) *sql.DB {
+	t.Helper()
+	_, db := newDB(t, p)
+	return db
+}
+
+// RunSQLTests creates a temporary database, deploys the project into it, and then runs each of
+// the project's SQL tests as a subtest of t, named after the test function. Subtests can be
+// selected in the usual way, e.g. go test -run 'TestSQL/account_create_test'. When a SQL test
+// fails, the error is logged with the SQL source where it occurred.
+//
+//	func TestSQL(t *testing.T) {
+//		p, err := pgpkg.NewProjectFrom("../schema")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//
+//		pgpkgtest.RunSQLTests(t, p)
+//	}
+//
+// The SQL tests share a single transaction, so the subtests are always run one at a time,
+// and must not call t.Parallel. The test fails immediately if a before- or after-function fails.
+func RunSQLTests(t *testing.T, p *pgpkg.Project) {
+	t.Helper()
+
+	// The tests are run below, so don't run them during deployment.
+	if p.Options == nil {
+		p.Options = pgpkg.Options.Copy()
+	}
+
+	skipTests := p.Options.SkipTests
+	p.Options.SkipTests = true
+	dsn, _ := newDB(t, p)
+	p.Options.SkipTests = skipTests
+
+	err := p.RunTestsWith(dsn, func(test *pgpkg.SQLTest) {
+		t.Run(test.Name, func(t *testing.T) {
+			if err := test.Run(); err != nil {
+				t.Error(formatError(err))
+			}
+		})
+	})
+
+	if err != nil {
+		t.Fatal(formatError(err))
+	}
+}
+
+// Create a temporary database and deploy the project into it. Returns the DSN of the database
+// and a connection to it.
+func newDB(t testing.TB, p *pgpkg.Project) (string, *sql.DB) {
+	t.Helper()
+
+	dsn := os.Getenv("PGPKG_DSN")
+	dbName, err := pgpkg.CreateTempDB(dsn)
+	if err != nil {
+		t.Fatalf("unable to create test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := pgpkg.DropTempDB(dsn, dbName); err != nil {
+			t.Errorf("unable to drop test database: %v", err)
+		}
+	})
+
+	if p.Options == nil {
+		p.Options = pgpkg.Options.Copy()
+	}
+
+	p.Options.DryRun = false
+	p.Options.KeepTestScripts = true
+
+	dbDSN := dsn + " dbname=" + dbName
+	db, err := p.Open(dbDSN)
+	if err != nil {
+		t.Fatalf("unable to deploy project into test database: %s", formatError(err))
+	}
+
+	// Cleanups are run in reverse order, so the connection is closed before the database is dropped.
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return dbDSN, db
+}
+
+// Format an error for the test log. For pgpkg errors, this includes the location and an excerpt
+// of the SQL source for each frame of the context, as printed by pgpkg.PrintError.
+func formatError(err error) string {
+	var pkgErr *pgpkg.PKGError
+	if !errors.As(err, &pkgErr) {
+		return err.Error()
+	}
+
+	var sb strings.Builder
+	for _, e := range append([]*pgpkg.PKGError{pkgErr}, pkgErr.Errors...) {
+		for _, rootErr := range e.UnwrapAll() {
+			sb.WriteString(rootErr.Error())
+			sb.WriteString("\n")
+			for c := rootErr.Context; c != nil; c = c.Next {
+				sb.WriteString(c.Location)
+				sb.WriteString("\n")
+				for _, line := range c.Excerpt(2) {
+					sb.WriteString(line)
+					sb.WriteString("\n")
+				}
+			}
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,36 @@
+package pgpkgtest
+
+import (
+	"testing"
+
+	"github.com/pgpkg/pgpkg"
+)
+
+func TestNewDB(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := pgpkg.NewProjectFrom("../tests/good/passing-tests")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db := NewDB(t, p)
+
+			// Test scripts are kept, so test functions can be called from Go.
+			if _, err = db.Exec("select passing_tests.t1_test()"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSQL(t *testing.T) {
+	p, err := pgpkg.NewProjectFrom("../tests/good/passing-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RunSQLTests(t, p)
+}
@@ -1,10 +1,18 @@
 package pgpkg
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 var dsn = os.Getenv("PGPKG_DSN")
@@ -75,6 +83,134 @@ func TestQuotedSchema(t *testing.T) {
 	testProject(t, dsn, false, false, "tests/good/quoted-schema")
 }
 
+func TestBaseline(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/baseline")
+}
+
+func TestIgnoreBaseline(t *testing.T) {
+	Options.IgnoreBaseline = true
+	defer func() { Options.IgnoreBaseline = false }()
+	testProject(t, dsn, false, false, "tests/good/baseline")
+}
+
+func TestRepeatable(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/repeatable")
+}
+
+func TestData(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/data")
+}
+
+func TestExpectError(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/expect-error")
+}
+
+func TestFixtures(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/fixtures")
+}
+
+func TestConditions(t *testing.T) {
+	testProject(t, dsn, false, false, "tests/good/conditions")
+}
+
+func TestGoMigration(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/go-migration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Use the project's own options, so the global options aren't changed for other tests.
+	p.Options = &OptionSet{DryRun: true}
+
+	ran := false
+	err = p.Root.RegisterMigration("0002_backfill_code", func(ctx context.Context, tx *PkgTx) error {
+		ran = true
+		_, err := tx.Exec("update go_migration.account set code = upper(name)")
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Migrate(dsn); !errors.Is(err, ErrDryRun) {
+		t.Fatal(err)
+	}
+
+	if !ran {
+		t.Fatal("Go migration was not run")
+	}
+}
+
+type goMigrationKey struct{}
+
+func TestGoMigrationContext(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/go-migration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{DryRun: true}
+
+	// The migration is passed the caller's context, and cancelling it stops the migration.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), goMigrationKey{}, "caller"))
+	defer cancel()
+
+	err = p.Root.RegisterMigration("0002_backfill_code", func(ctx context.Context, tx *PkgTx) error {
+		if ctx.Value(goMigrationKey{}) != "caller" {
+			t.Error("Go migration was not passed the caller's context")
+		}
+
+		cancel()
+		_, err := tx.Exec("update go_migration.account set code = upper(name)")
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.MigrateContext(ctx, dsn)
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, sql.ErrTxDone) {
+		t.Fatalf("expected the migration to be cancelled: %v", err)
+	}
+}
+
+func TestGenerateMigration(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/generate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	tempDBName, err := CreateTempDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DropTempDB(dsn, tempDBName)
+
+	tempDSN := dsn + " dbname=" + tempDBName
+	if err = p.Migrate(tempDSN); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := p.Root.GenerateMigration(tempDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`alter table "generate"."account" alter column "name" type character varying(80) using "name"::character varying(80);`,
+		`alter table "generate"."account" alter column "name" set not null;`,
+		`-- alter table "generate"."account" drop column "legacy_code";`,
+		"balance numeric(12, 2) NOT NULL DEFAULT 0",
+		"create table generate.ledger",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("generated migration does not contain %s:\n%s", expected, script)
+		}
+	}
+}
+
 func TestBadSchemaName(t *testing.T) {
 	testProject(t, dsn, false, true, "tests/bad/bad-schema-name")
 }
@@ -114,3 +250,494 @@ func TestBadTableRef(t *testing.T) {
 func TestBadTextException(t *testing.T) {
 	testProject(t, dsn, false, true, "tests/bad/test-exception")
 }
+
+func TestBadUnexpectedSuccess(t *testing.T) {
+	testProject(t, dsn, false, true, "tests/bad/unexpected-success")
+}
+
+func TestFailedPrecondition(t *testing.T) {
+	testProject(t, dsn, false, true, "tests/bad/failed-precondition")
+}
+
+// Create a temporary database for a test, which is dropped when the test completes.
+func testTempDB(t *testing.T) string {
+	tempDBName, err := CreateTempDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := DropTempDB(dsn, tempDBName); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return dsn + " dbname=" + tempDBName
+}
+
+// Run a query which returns a single value.
+func queryValue(t *testing.T, tempDSN string, query string, args ...any) string {
+	db, err := sql.Open("postgres", tempDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var value string
+	if err = db.QueryRow(query, args...).Scan(&value); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	return value
+}
+
+// Run SQL statements, such as those which create objects by hand.
+func execSQL(t *testing.T, tempDSN string, script string) {
+	db, err := sql.Open("postgres", tempDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec(script); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateDB(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/adopt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	// A unique label, so that templates built by other runs aren't dropped.
+	label := "template test " + MkTempDbName()
+	templateDB := func() string {
+		template, err := p.TemplateDB(dsn, label, fmt.Sprintf("%016x", rand.Uint64()), func(string) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = DropTempDB(dsn, template) })
+		return template
+	}
+
+	first := templateDB()
+
+	// Copying the template waits until it isn't in use.
+	db, err := sql.Open("postgres", dsn+" dbname="+first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(time.Second)
+		_ = db.Close()
+	}()
+
+	clone, err := CreateTempDBFrom(dsn, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = DropTempDB(dsn, clone); err != nil {
+		t.Fatal(err)
+	}
+
+	// Building a new template for the same label drops the previous one.
+	second := templateDB()
+
+	if exists := queryValue(t, dsn, "select exists (select 1 from pg_database where datname = $1)", first); exists != "false" {
+		t.Errorf("previous template %s was not dropped", first)
+	}
+
+	if exists := queryValue(t, dsn, "select exists (select 1 from pg_database where datname = $1)", second); exists != "true" {
+		t.Errorf("template %s does not exist", second)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	tempDSN := testTempDB(t)
+
+	// The first migration, and the function, were created by hand.
+	execSQL(t, tempDSN, `
+		create schema adopt;
+		create table adopt.account (id integer primary key, name text not null);
+		create function adopt.account_name(_id integer) returns text language sql as
+			$$ select name from adopt.account where id = _id; $$;`)
+
+	owner := queryValue(t, tempDSN, "select pg_get_userbyid(relowner) from pg_class where oid = 'adopt.account'::regclass")
+
+	// Without --transfer-ownership, nothing is re-owned.
+	p, err := NewProjectFrom("tests/good/adopt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.Adopt(tempDSN, "account.sql", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if newOwner := queryValue(t, tempDSN, "select pg_get_userbyid(relowner) from pg_class where oid = 'adopt.account'::regclass"); newOwner != owner {
+		t.Errorf("table was re-owned by %s without --transfer-ownership", newOwner)
+	}
+
+	if migrations := queryValue(t, tempDSN, "select string_agg(path, ',' order by path) from pgpkg.migration where pkg = $1", p.Root.Name); migrations != "account.sql" {
+		t.Errorf("unexpected adopted migrations: %s", migrations)
+	}
+
+	if objects := queryValue(t, tempDSN, "select count(*) from pgpkg.managed_object where pkg = $1 and obj_type = 'function'", p.Root.Name); objects != "1" {
+		t.Errorf("expected the function to be adopted; found %s managed object(s)", objects)
+	}
+
+	// Adopted objects can be verified, so changes made after adoption are found.
+	execSQL(t, tempDSN, `
+		create or replace function adopt.account_name(_id integer) returns text language sql as
+			$$ select upper(name) from adopt.account where id = _id; $$;`)
+
+	if drift := verifyProject(t, tempDSN, "tests/good/adopt"); !hasProblem(drift, "changed") {
+		t.Errorf("expected the adopted function to have changed: %v", drift)
+	}
+
+	// With --transfer-ownership, the package role owns the table, so the next migration can change it.
+	p, err = NewProjectFrom("tests/good/adopt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.Adopt(tempDSN, "account.sql", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if newOwner := queryValue(t, tempDSN, "select pg_get_userbyid(relowner) from pg_class where oid = 'adopt.account'::regclass"); newOwner != p.Root.RoleName {
+		t.Errorf("table is owned by %s, not %s", newOwner, p.Root.RoleName)
+	}
+
+	p, err = NewProjectFrom("tests/good/adopt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.Migrate(tempDSN); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tempDSN := testTempDB(t)
+
+	execSQL(t, tempDSN, `
+		create schema extract;
+		create table extract.account (id integer primary key, name text not null default '');
+		create index account_name on extract.account (name);
+		create function extract.account_name(_id integer) returns text language sql as
+			$$ select name from extract.account where id = _id; $$;
+		create view extract.account_names as select id, name from extract.account;`)
+
+	dir := t.TempDir()
+	if err := Extract(tempDSN, "extract", "github.com/pgpkg/extract", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewProjectFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.Adopt(tempDSN, "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// The extracted package can be deployed to the database it came from.
+	p, err = NewProjectFrom(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{DryRun: true}
+
+	if err = p.Migrate(tempDSN); !errors.Is(err, ErrDryRun) {
+		t.Fatal(err)
+	}
+}
+
+func TestImportSqitchHistory(t *testing.T) {
+	tempDSN := testTempDB(t)
+
+	// The database is shared by two sqitch projects.
+	execSQL(t, tempDSN, `
+		create schema sqitch;
+		create table sqitch.changes (change text, project text, committed_at timestamptz default now());
+		insert into sqitch.changes (change, project) values ('account', 'ledger'), ('account@001', 'other');`)
+
+	p, err := NewProjectFrom("tests/good/baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.ImportHistory(tempDSN, "sqitch", "", ""); err == nil {
+		t.Fatal("expected an error when the sqitch project isn't given")
+	}
+
+	if err = p.ImportHistory(tempDSN, "sqitch", "", "ledger"); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrations := queryValue(t, tempDSN, "select string_agg(path, ',' order by path) from pgpkg.migration where pkg = $1", p.Root.Name); migrations != "account.sql" {
+		t.Errorf("unexpected imported migrations: %s", migrations)
+	}
+}
+
+// Deploy a package into a database, and commit the changes.
+func deployProject(t *testing.T, tempDSN string, pkgPath string) {
+	p, err := NewProjectFrom(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	if err = p.Migrate(tempDSN); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Plan a deployment of a package.
+func planProject(t *testing.T, tempDSN string, pkgPath string) *PackagePlan {
+	p, err := NewProjectFrom(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	plan, err := p.Plan(tempDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pp := range plan.Packages {
+		if pp.Name == p.Root.Name {
+			return pp
+		}
+	}
+
+	t.Fatalf("no plan for package %s", p.Root.Name)
+	return nil
+}
+
+func TestPlan(t *testing.T) {
+	tempDSN := testTempDB(t)
+
+	// Copy the package, so that its managed objects can be changed.
+	pkgPath := t.TempDir()
+	if err := os.CopyFS(pkgPath, os.DirFS("tests/good/adopt")); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := planProject(t, tempDSN, pkgPath)
+	if !pp.New || len(pp.Migrations) != 2 || len(pp.Created) != 1 {
+		t.Errorf("unexpected plan for a new package: %+v", pp)
+	}
+
+	deployProject(t, tempDSN, pkgPath)
+
+	pp = planProject(t, tempDSN, pkgPath)
+	if pp.HasChanges() {
+		t.Errorf("unexpected plan after deployment: %+v", pp)
+	}
+
+	var out bytes.Buffer
+	(&Plan{Packages: []*PackagePlan{pp}}).Print(&out)
+	if !strings.Contains(out.String(), "(no changes)") {
+		t.Errorf("plan output doesn't say there are no changes:\n%s", out.String())
+	}
+
+	err := os.WriteFile(path.Join(pkgPath, "account.sql"), []byte(`
+create or replace function adopt.account_name(_id integer) returns text language sql as $$
+    select upper(name) from adopt.account where id = _id;
+$$;`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp = planProject(t, tempDSN, pkgPath)
+	if pp.New || len(pp.Migrations) != 0 || len(pp.Created) != 0 || len(pp.Changed) != 1 || len(pp.Dropped) != 0 {
+		t.Errorf("unexpected plan after changing a managed object: %+v", pp)
+	}
+}
+
+// Verify a package, and return the problems found, by object type.
+func verifyProject(t *testing.T, tempDSN string, pkgPath string) map[string]string {
+	p, err := NewProjectFrom(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Options = &OptionSet{}
+
+	drift, err := p.Verify(tempDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems := make(map[string]string)
+	for _, d := range drift {
+		problems[d.ObjectType+" "+d.ObjectName] = d.Problem
+	}
+
+	return problems
+}
+
+func TestVerify(t *testing.T) {
+	tempDSN := testTempDB(t)
+	deployProject(t, tempDSN, "tests/good/adopt")
+
+	if drift := verifyProject(t, tempDSN, "tests/good/adopt"); len(drift) != 0 {
+		t.Fatalf("unexpected drift after deployment: %v", drift)
+	}
+
+	// Change the managed function, and add one that isn't managed.
+	execSQL(t, tempDSN, `
+		create or replace function adopt.account_name(_id integer) returns text language sql as
+			$$ select upper(name) from adopt.account where id = _id; $$;
+		create function adopt.extra() returns integer language sql as $$ select 1 $$;`)
+
+	drift := verifyProject(t, tempDSN, "tests/good/adopt")
+	if len(drift) != 2 || !hasProblem(drift, "changed") || drift["function adopt.extra()"] != "unmanaged" {
+		t.Fatalf("unexpected drift after changing the database: %v", drift)
+	}
+
+	// Drop the managed function.
+	execSQL(t, tempDSN, "drop function adopt.account_name(integer)")
+
+	drift = verifyProject(t, tempDSN, "tests/good/adopt")
+	if len(drift) != 2 || !hasProblem(drift, "missing") {
+		t.Fatalf("unexpected drift after dropping a function: %v", drift)
+	}
+}
+
+func hasProblem(drift map[string]string, problem string) bool {
+	for _, p := range drift {
+		if p == problem {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Create a previous release of a package, as an exported ZIP file. The release is a copy of the
+// package with the given pgpkg.toml, and without the given files.
+func exportRelease(t *testing.T, pkgPath string, config string, remove ...string) string {
+	releasePath := t.TempDir()
+	if err := os.CopyFS(releasePath, os.DirFS(pkgPath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path.Join(releasePath, "pgpkg.toml"), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range remove {
+		if err := os.Remove(path.Join(releasePath, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewProjectFrom(releasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zipPath := path.Join(t.TempDir(), "release.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	if err = WriteProject(zipWriter, p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return zipPath
+}
+
+// The first release of tests/good/baseline, which only had the first migration.
+const baselineRelease = `Package = "github.com/pgpkg/baseline"
+Schemas = [ "baseline" ]
+Migrations = [ "schema/account.sql" ]
+`
+
+var baselineReleaseRemoved = []string{"schema/account@001.sql", "schema/account@002.sql", "schema/baseline.sql", "account_test.sql"}
+
+func TestUpgradeFromRelease(t *testing.T) {
+	// Packages which list their migrations in pgpkg.toml can be exported and reloaded.
+	zipPath := exportRelease(t, "tests/good/baseline", baselineRelease, baselineReleaseRemoved...)
+
+	tempDSN := testTempDB(t)
+	deployProject(t, tempDSN, zipPath)
+
+	// The upgrade runs the migrations that weren't in the release, rather than the baseline.
+	deployProject(t, tempDSN, "tests/good/baseline")
+
+	if migrations := queryValue(t, tempDSN, "select string_agg(path, ',' order by path) from pgpkg.migration where pkg = 'github.com/pgpkg/baseline'"); migrations != "account.sql,account@001.sql,account@002.sql" {
+		t.Errorf("unexpected migrations after upgrade: %s", migrations)
+	}
+}
+
+// Compare an upgrade from a previous release with a fresh install of a package, as
+// pgpkg check-upgrade does.
+func checkUpgrade(t *testing.T, pkgPath string, zipPath string) []CatalogDiff {
+	upgradeDSN := testTempDB(t)
+	deployProject(t, upgradeDSN, zipPath)
+	deployProject(t, upgradeDSN, pkgPath)
+
+	freshDSN := testTempDB(t)
+	deployProject(t, freshDSN, pkgPath)
+
+	p, err := NewProjectFrom(pkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := CompareCatalogs(upgradeDSN, freshDSN, p.Root.SchemaNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return diffs
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	zipPath := exportRelease(t, "tests/good/baseline", baselineRelease, baselineReleaseRemoved...)
+
+	if diffs := checkUpgrade(t, "tests/good/baseline", zipPath); len(diffs) != 0 {
+		t.Fatalf("upgrade differs from a fresh install: %v", diffs)
+	}
+}
+
+func TestCheckUpgradeDrift(t *testing.T) {
+	zipPath := exportRelease(t, "tests/bad/upgrade-drift", `Package = "github.com/pgpkg/upgrade-drift"
+Schemas = [ "upgrade_drift" ]
+Migrations = [ "schema/account.sql" ]
+`, "schema/account@001.sql", "schema/baseline.sql")
+
+	// The baseline forgot that name is not null.
+	diffs := checkUpgrade(t, "tests/bad/upgrade-drift", zipPath)
+	if len(diffs) != 1 || diffs[0].Key != "column upgrade_drift.account.name" {
+		t.Fatalf("unexpected differences between upgrade and fresh install: %v", diffs)
+	}
+}
@@ -0,0 +1,344 @@
+package pgpkg
+
+// A Plan describes what a deployment would do, without doing it. Plans are built by comparing
+// the project with the state recorded in the pgpkg schema; nothing is executed, so a plan can't
+// tell if a deployment will succeed. Use `pgpkg try` for that.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Plan describes the changes a deployment would make to each package in a project.
+type Plan struct {
+	Packages     []*PackagePlan `json:"packages"`               // packages, in installation order
+	NotInProject []string       `json:"notInProject,omitempty"` // installed packages which aren't part of the project
+}
+
+// PackagePlan describes the changes a deployment would make to a single package.
+type PackagePlan struct {
+	Name        string   `json:"name"`
+	New         bool     `json:"new"`                   // the package has never been installed
+	Baseline    string   `json:"baseline,omitempty"`    // baseline that would be used for a fresh install
+	Migrations  []string `json:"migrations,omitempty"`  // pending migrations, in order
+	Repeatables []string `json:"repeatables,omitempty"` // repeatable migrations that have changed
+	Data        []string `json:"data,omitempty"`        // data files, which are loaded on every deployment
+	Created     []string `json:"created,omitempty"`     // managed objects which would be created
+	Changed     []string `json:"changed,omitempty"`     // managed objects whose source has changed
+	Dropped     []string `json:"dropped,omitempty"`     // managed objects which would be dropped
+	UsesAdded   []string `json:"usesAdded,omitempty"`   // packages this package would be granted access to
+	UsesRemoved []string `json:"usesRemoved,omitempty"` // packages removed from the Uses clause
+}
+
+// The state of the database, as recorded in the pgpkg schema.
+type planState struct {
+	installed  map[string][]string          // installed packages, and the packages they use
+	migrations map[string]map[string]string // migrations for each package, with the hash of repeatable migrations
+	objects    map[string]map[string]string // managed objects for each package, with the hash of their source
+}
+
+// Read the recorded state of the database. Columns which might not exist yet, because pgpkg
+// hasn't been upgraded, are read using to_jsonb().
+func readPlanState(tx *PkgTx) (*planState, error) {
+	state := &planState{
+		installed:  make(map[string][]string),
+		migrations: make(map[string]map[string]string),
+		objects:    make(map[string]map[string]string),
+	}
+
+	var hasSchema bool
+	if err := tx.QueryRow("select exists (select 1 from pg_namespace where nspname = 'pgpkg')").Scan(&hasSchema); err != nil {
+		return nil, fmt.Errorf("unable to read pgpkg schema: %w", err)
+	}
+
+	if !hasSchema {
+		return state, nil
+	}
+
+	rows, err := tx.Query("select pkg, coalesce(uses, '{}') from pgpkg.pkg")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read packages: %w", err)
+	}
+
+	for rows.Next() {
+		var pkg string
+		var uses []string
+		if err = rows.Scan(&pkg, pq.Array(&uses)); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("unable to read packages: %w", err)
+		}
+		state.installed[pkg] = uses
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read packages: %w", err)
+	}
+
+	for _, q := range []struct {
+		query string
+		dest  map[string]map[string]string
+	}{
+		{"select pkg, path, coalesce(to_jsonb(m)->>'hash', '') from pgpkg.migration m", state.migrations},
+		{"select pkg, obj_type || ' ' || obj_name, coalesce(to_jsonb(o)->>'src_hash', '') from pgpkg.managed_object o", state.objects},
+	} {
+		rows, err := tx.Query(q.query)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read package state: %w", err)
+		}
+
+		for rows.Next() {
+			var pkg, name, hash string
+			if err = rows.Scan(&pkg, &name, &hash); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("unable to read package state: %w", err)
+			}
+
+			if q.dest[pkg] == nil {
+				q.dest[pkg] = make(map[string]string)
+			}
+			q.dest[pkg][name] = hash
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("unable to read package state: %w", err)
+		}
+	}
+
+	return state, nil
+}
+
+// Work out which migrations would be run, using the same rules as Schema.Apply.
+func (s *Schema) plan(pp *PackagePlan, migrated map[string]string) error {
+	done := make(map[string]bool)
+	for name := range migrated {
+		done[name] = true
+	}
+
+	if s.baselinePath != "" && len(migrated) == 0 && !s.Package.options().IgnoreBaseline {
+		pp.Baseline = filepath.Base(s.baselinePath)
+		for _, migrationPath := range s.migrationIndex {
+			migrationName := filepath.Base(migrationPath)
+			done[migrationName] = true
+			if migrationName == s.baselineThrough {
+				break
+			}
+		}
+	}
+
+	for _, migrationPath := range s.migrationIndex {
+		if migrationName := filepath.Base(migrationPath); !done[migrationName] {
+			pp.Migrations = append(pp.Migrations, migrationName)
+		}
+	}
+
+	for _, repeatablePath := range s.repeatableIndex {
+		unit, ok := s.getUnit(repeatablePath)
+		if !ok {
+			return fmt.Errorf("error: unit not found: %s", repeatablePath)
+		}
+
+		hash, err := unit.Hash()
+		if err != nil {
+			return err
+		}
+
+		if repeatableName := filepath.Base(repeatablePath); migrated[repeatableName] != hash {
+			pp.Repeatables = append(pp.Repeatables, repeatableName)
+		}
+	}
+
+	return nil
+}
+
+// Compare the managed objects in the MOB with those recorded in the database.
+func (m *MOB) plan(pp *PackagePlan, recorded map[string]string) error {
+	if m.HasUnits() {
+		if err := m.Parse(); err != nil {
+			return err
+		}
+
+		for _, stmt := range m.state.pending {
+			obj, err := stmt.GetManagedObject()
+			if err != nil {
+				return err
+			}
+
+			name := obj.ObjectType + " " + obj.ObjectName
+			hash, ok := recorded[name]
+			switch {
+			case !ok:
+				pp.Created = append(pp.Created, name)
+			case hash != stmt.sourceHash():
+				pp.Changed = append(pp.Changed, name)
+			}
+			delete(recorded, name)
+		}
+	}
+
+	for name := range recorded {
+		pp.Dropped = append(pp.Dropped, name)
+	}
+	sort.Strings(pp.Dropped)
+
+	return nil
+}
+
+// Return the strings in a which are not in b.
+func missingFrom(a []string, b []string) []string {
+	var missing []string
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			if s == t {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, s)
+		}
+	}
+
+	return missing
+}
+
+// Plan works out what a deployment of the project to the given database would do, without
+// changing the database.
+func (p *Project) Plan(dsn string) (*Plan, error) {
+	if err := p.Parse(); err != nil {
+		return nil, err
+	}
+
+	pkgNames, err := p.sortPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	// Nothing is changed.
+	defer dbtx.Rollback()
+
+	state, err := readPlanState(&PkgTx{Tx: dbtx, options: p.options()})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+
+	for _, pkgName := range pkgNames {
+		pkg := p.pkgs[pkgName]
+		uses, installed := state.installed[pkgName]
+
+		pp := &PackagePlan{
+			Name:        pkgName,
+			New:         !installed,
+			UsesAdded:   missingFrom(pkg.config.Uses, uses),
+			UsesRemoved: missingFrom(uses, pkg.config.Uses),
+		}
+
+		if err = pkg.Schema.plan(pp, state.migrations[pkgName]); err != nil {
+			return nil, err
+		}
+
+		if err = pkg.MOB.plan(pp, state.objects[pkgName]); err != nil {
+			return nil, err
+		}
+
+		for _, df := range pkg.Data.files {
+			pp.Data = append(pp.Data, df.unit.Path)
+		}
+
+		plan.Packages = append(plan.Packages, pp)
+	}
+
+	for pkgName := range state.installed {
+		if _, ok := p.pkgs[pkgName]; !ok {
+			plan.NotInProject = append(plan.NotInProject, pkgName)
+		}
+	}
+	sort.Strings(plan.NotInProject)
+
+	return plan, nil
+}
+
+// HasChanges reports if a deployment would change anything other than reloading data files.
+func (pp *PackagePlan) HasChanges() bool {
+	return pp.New || pp.Baseline != "" || len(pp.Migrations) > 0 || len(pp.Repeatables) > 0 ||
+		len(pp.Created) > 0 || len(pp.Changed) > 0 || len(pp.Dropped) > 0 ||
+		len(pp.UsesAdded) > 0 || len(pp.UsesRemoved) > 0
+}
+
+// WriteJSON writes the plan as JSON.
+func (plan *Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
+
+// Print writes a human-readable description of the plan.
+func (plan *Plan) Print(w io.Writer) {
+	printList := func(heading string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "  %s:\n", heading)
+		for _, item := range items {
+			_, _ = fmt.Fprintf(w, "    %s\n", item)
+		}
+	}
+
+	for _, pp := range plan.Packages {
+		var status []string
+		if pp.New {
+			status = append(status, "new package")
+		}
+
+		if !pp.HasChanges() {
+			status = append(status, "no changes")
+		}
+
+		if len(status) > 0 {
+			_, _ = fmt.Fprintf(w, "%s (%s)\n", pp.Name, strings.Join(status, ", "))
+		} else {
+			_, _ = fmt.Fprintln(w, pp.Name)
+		}
+
+		if pp.Baseline != "" {
+			_, _ = fmt.Fprintf(w, "  baseline: %s\n", pp.Baseline)
+		}
+
+		printList("migrations", pp.Migrations)
+		printList("repeatable migrations", pp.Repeatables)
+		printList("data files", pp.Data)
+		printList("create", pp.Created)
+		printList("change", pp.Changed)
+		printList("drop", pp.Dropped)
+		printList("grant access to", pp.UsesAdded)
+		printList("removed from Uses", pp.UsesRemoved)
+	}
+
+	if len(plan.NotInProject) > 0 {
+		_, _ = fmt.Fprintln(w, "installed packages not in this project (unchanged):")
+		for _, pkgName := range plan.NotInProject {
+			_, _ = fmt.Fprintf(w, "  %s\n", pkgName)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package pgpkg
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/lib/pq"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 // The "volume level" is incremented or decremented to supress messages from the database.
@@ -12,25 +14,42 @@ import (
 // when it isn't. These messages are great during debugging but should be silenced during
 // operations that will generate them spuriously; sometimes PG itself emits them when we
 // don't want them.
-var logVolume = 0
+var logVolume atomic.Int32
 
-func noticeHandler(err *pq.Error) {
+func noticeHandler(options *OptionSet, err *pq.Error) {
 	// Don't allow warnings to be quiet.
 	if err.Severity == "WARNING" {
 		Stderr.Printf("[%s] %s\n", strings.ToUpper(err.Severity), err.Message)
 	} else {
-		if logVolume == 0 || Options.Verbose {
+		if logVolume.Load() == 0 || options.Verbose {
 			Stdout.Printf("[%s] %s\n", strings.ToLower(err.Severity), err.Message)
 		}
 	}
 }
 
+// Open a database connection which prints notices from the database. Notices are printed
+// according to the given options.
+func openDB(dsn string, options *OptionSet) (*sql.DB, error) {
+	base, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connection to database: %w", err)
+	}
+
+	// Wrap the connector to print out notices. Capture the options in the handler.
+	connector := pq.ConnectorWithNoticeHandler(base,
+		func(err *pq.Error) {
+			noticeHandler(options, err)
+		})
+
+	return sql.OpenDB(connector), nil
+}
+
 func LogQuieter() {
-	logVolume--
+	logVolume.Add(-1)
 }
 
 func LogLouder() {
-	logVolume++
+	logVolume.Add(1)
 }
 
 var fnamePattern = regexp.MustCompile("function ([a-z_][a-z0-9_.]*[(].*[)])")
@@ -1,11 +1,13 @@
 package pgpkg
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
-	"github.com/lib/pq"
 	"io/fs"
+	"sort"
 )
 
 // Project represents a collection of individual packages that are to be installed into a single
@@ -25,6 +27,12 @@ type Project struct {
 	pkgs    map[string]*Package
 	Cache   *WriteCache // primary cache for this project
 	Search  []Cache     // other caches to search for dependencies.
+
+	TestResults []*TestResult // results of the tests run by the most recent call to Open
+
+	// Options for this project. If nil, the global Options are used. Projects with their own
+	// options can be used at the same time as each other, for example in parallel Go tests.
+	Options *OptionSet
 }
 
 func (p *Project) AddEmbeddedFS(f fs.FS, path string) (*Package, error) {
@@ -173,30 +181,31 @@ func (p *Project) resolveDependencies() error {
 // If dsn is an empty string, pgpkg will attempt to use the PGPKG_DSN environment
 // variable. If PGPKG_DSN is not set, pgpkg will use the usual libpq PG environment variables.
 func (p *Project) Open(dsn string) (*sql.DB, error) {
+	return p.OpenContext(context.Background(), dsn)
+}
+
+// OpenContext is like Open, but the installation is cancelled, and rolled back, if ctx is done
+// before it completes. The context is passed to Go migrations.
+func (p *Project) OpenContext(ctx context.Context, dsn string) (*sql.DB, error) {
 	if err := p.Parse(); err != nil {
 		return nil, err
 	}
 
-	base, err := pq.NewConnector(dsn)
+	db, err := openDB(dsn, p.options())
 	if err != nil {
-		return nil, fmt.Errorf("connection to database: %w", err)
+		return nil, err
 	}
 
-	// Wrap the connector to print out notices. Capture the options in the handler.
-	connector := pq.ConnectorWithNoticeHandler(base,
-		func(err *pq.Error) {
-			noticeHandler(err)
-		})
-
-	db := sql.OpenDB(connector)
-
-	dbtx, err := db.Begin()
+	dbtx, err := db.BeginTx(ctx, nil)
 	if err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("unable to begin transaction: %w", err)
 	}
 
 	tx := &PkgTx{
-		Tx: dbtx,
+		Tx:      dbtx,
+		ctx:     ctx,
+		options: p.options(),
 	}
 
 	// Initialise pgpkg itself.
@@ -205,13 +214,23 @@ func (p *Project) Open(dsn string) (*sql.DB, error) {
 		return nil, fmt.Errorf("unable to initialize pgpkg: %w", err)
 	}
 
-	if err := p.installPackages(tx); err != nil {
+	p.TestResults = nil
+	installErr := p.installPackages(tx)
+
+	// Reports are written even if the installation failed, since that's when they are most useful.
+	if !p.options().SkipTests {
+		if reportErr := p.WriteTestReports(); reportErr != nil {
+			installErr = errors.Join(installErr, reportErr)
+		}
+	}
+
+	if installErr != nil {
 		_ = tx.Rollback()
 		_ = db.Close()
-		return nil, fmt.Errorf("unable to complete package installation: %w", err)
+		return nil, fmt.Errorf("unable to complete package installation: %w", installErr)
 	}
 
-	if Options.DryRun {
+	if p.options().DryRun {
 		err = tx.Rollback()
 		_ = db.Close()
 		if err != nil {
@@ -230,8 +249,193 @@ func (p *Project) Open(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
+// Get the options used by the project.
+func (p *Project) options() *OptionSet {
+	if p.Options != nil {
+		return p.Options
+	}
+
+	return &Options
+}
+
+// RunTests runs the tests of each package in the project against the database given by dsn,
+// which must already contain the project. Nothing is migrated, and the database is not changed.
+//
+// The tests are shared between a number of workers, and only the share of the given worker
+// (numbered from zero) is run. This is used to run the tests in parallel, in several copies of
+// the same database. To run all the tests, set workers to 1.
+func (p *Project) RunTests(dsn string, worker int, workers int) error {
+	return p.runTests(context.Background(), dsn, worker, workers, nil)
+}
+
+// RunTestsContext is like RunTests, but the tests are stopped if ctx is done before they complete.
+func (p *Project) RunTestsContext(ctx context.Context, dsn string, worker int, workers int) error {
+	return p.runTests(ctx, dsn, worker, workers, nil)
+}
+
+// RunTestsWith runs the tests of each package in the project against the database given by dsn,
+// as with RunTests, but each test is passed to runner, which decides whether to run it, and
+// reports the result. This is used to run SQL tests as Go subtests; see the pgpkgtest package.
+//
+// Test failures are reported to the runner and are not returned; RunTestsWith only returns
+// errors which stop the tests from running, including failures of before- and after-functions.
+func (p *Project) RunTestsWith(dsn string, runner func(test *SQLTest)) error {
+	return p.runTests(context.Background(), dsn, 0, 1, runner)
+}
+
+func (p *Project) runTests(ctx context.Context, dsn string, worker int, workers int, runner func(test *SQLTest)) error {
+	if err := p.Parse(); err != nil {
+		return err
+	}
+
+	pkgNames, err := p.sortPackages()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dbtx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	tx := &PkgTx{Tx: dbtx, ctx: ctx, options: p.options()}
+	defer tx.Rollback()
+
+	p.TestResults = nil
+	for _, pkgName := range pkgNames {
+		pkg := p.pkgs[pkgName]
+		if pkg.Tests == nil || !pkg.Tests.HasUnits() {
+			continue
+		}
+
+		pkg.Tests.worker, pkg.Tests.workers = worker, workers
+		pkg.Tests.runner = runner
+		pkg.setRole(tx)
+		if err = pkg.Tests.Run(tx); err != nil {
+			return fmt.Errorf("unable to run tests for package %s: %w", pkg.Name, err)
+		}
+		pkg.resetRole(tx)
+	}
+
+	return nil
+}
+
+// KeepFailedTest recreates the state in which the first failed test of the last test run was run,
+// in the database given by dsn, and commits it, so that the database can be inspected.
+// The database must already contain the project, and is usually the one the tests were run in.
+// Returns the failed test, or nil if no test failed, in which case the database isn't changed.
+//
+// The state is that just before the failed test was run, including the test scripts. If
+// CommitFailedTest is set, the effects of the failed test's setup functions, and of the test
+// itself, are also kept, up to the first error.
+func (p *Project) KeepFailedTest(dsn string) (*TestResult, error) {
+	var failed *TestResult
+	for _, result := range p.TestResults {
+		if result.Failed() {
+			failed = result
+			break
+		}
+	}
+
+	if failed == nil {
+		return nil, nil
+	}
+
+	pkg, ok := p.pkgs[failed.Package]
+	if !ok || pkg.Tests == nil {
+		return nil, fmt.Errorf("unable to find tests for package %s", failed.Package)
+	}
+
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	tx := &PkgTx{Tx: dbtx, options: p.options()}
+	pkg.setRole(tx)
+	if err = pkg.Tests.replay(tx, failed.Name); err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("unable to recreate failed test %s: %w", failed.Name, err)
+	}
+	pkg.resetRole(tx)
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("unable to commit failed test %s: %w", failed.Name, err)
+	}
+
+	return failed, nil
+}
+
+// updatePgpkg opens the database, installs (or upgrades) the pgpkg package itself, and then calls
+// update, all within a single transaction. This is used by operations which update pgpkg's
+// records of a package without installing it. The transaction is committed if update succeeds,
+// unless this is a dry run.
+func (p *Project) updatePgpkg(dsn string, update func(tx *PkgTx) error) error {
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	tx := &PkgTx{
+		Tx:      dbtx,
+		options: p.options(),
+	}
+
+	if err := p.Init(tx); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("unable to initialize pgpkg: %w", err)
+	}
+
+	if err := p.pkgs["github.com/pgpkg/pgpkg"].Apply(tx); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("unable to install pgpkg: %w", err)
+	}
+
+	if err := update(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if p.options().DryRun {
+		if err = tx.Rollback(); err != nil {
+			return err
+		}
+		return ErrDryRun
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit changes: %w", err)
+	}
+
+	return nil
+}
+
 func (p *Project) Migrate(dsn string) error {
-	db, err := p.Open(dsn)
+	return p.MigrateContext(context.Background(), dsn)
+}
+
+// MigrateContext is like Migrate, but the migration is cancelled, and rolled back, if ctx is done
+// before it completes. The context is passed to Go migrations.
+func (p *Project) MigrateContext(ctx context.Context, dsn string) error {
+	db, err := p.OpenContext(ctx, dsn)
 	if err != nil {
 		return err
 	}
@@ -342,6 +546,21 @@ func NewProjectFrom(pkgPath string, searchCaches ...Cache) (*Project, error) {
 	return p, nil
 }
 
+// SchemaNames returns the names of the schemas used by all the packages in the project,
+// other than pgpkg itself, in sorted order.
+func (p *Project) SchemaNames() []string {
+	var schemaNames []string
+	for name, pkg := range p.pkgs {
+		if name == "github.com/pgpkg/pgpkg" {
+			continue
+		}
+		schemaNames = append(schemaNames, pkg.SchemaNames...)
+	}
+
+	sort.Strings(schemaNames)
+	return schemaNames
+}
+
 func (p *Project) PrintInfo(w InfoWriter) {
 	var srcLocations []string
 	for _, s := range p.Sources {
@@ -23,12 +23,23 @@ type Schema struct {
 	migrationPaths map[string]bool // list of paths that need to be migrated, as a map.
 	migrationState map[string]bool // set of paths that have already been migrated (loaded from DB)
 	migratedState  map[string]bool // set of paths that have been newly migrated
+
+	repeatableIndex []string          // list of paths that are migrated whenever their contents change
+	repeatableState map[string]string // hash of each repeatable migration when it was last run (loaded from DB)
+	repeatedState   map[string]string // hash of each repeatable migration that has been newly migrated
+
+	baselinePath    string // consolidated migration script used for fresh installs, if any
+	baselineThrough string // name of the last migration covered by the baseline
+	useBaseline     bool   // the package has never been migrated, so the baseline will be used
+
+	checkUnits map[string]*Unit // ".check.sql" files containing conditions, indexed by migration path
 }
 
 func NewSchema(p *Package) *Schema {
 	return &Schema{
 		Bundle:         p.newBundle(),
 		migrationPaths: make(map[string]bool),
+		checkUnits:     make(map[string]*Unit),
 	}
 }
 
@@ -45,6 +56,15 @@ func (s *Schema) ApplyUnit(tx *PkgTx, u *Unit) error {
 		return fmt.Errorf("unable to upgrade schema: %w", err)
 	}
 
+	conditions, err := s.conditions(u)
+	if err != nil {
+		return fmt.Errorf("unable to upgrade schema: %w", err)
+	}
+
+	if err = checkConditions(tx, conditions, preconditionKind); err != nil {
+		return fmt.Errorf("unable to upgrade schema: %w", err)
+	}
+
 	for _, stmt := range u.Statements {
 		_, err := stmt.Try(tx)
 		if err != nil {
@@ -52,6 +72,55 @@ func (s *Schema) ApplyUnit(tx *PkgTx, u *Unit) error {
 		}
 	}
 
+	if err = checkConditions(tx, conditions, postconditionKind); err != nil {
+		return fmt.Errorf("unable to upgrade schema: %w", err)
+	}
+
+	return nil
+}
+
+// Find the conditions for a migration unit, from both the unit's header and its check file.
+func (s *Schema) conditions(u *Unit) ([]*condition, error) {
+	conditions, err := parseConditions(u, true)
+	if err != nil {
+		return nil, err
+	}
+
+	checkUnit, ok := s.checkUnits[u.Path]
+	if !ok {
+		return conditions, nil
+	}
+
+	if err = checkUnit.Parse(); err != nil {
+		return nil, err
+	}
+
+	checks, err := parseConditions(checkUnit, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(conditions, checks...), nil
+}
+
+// Return the path of the check file for a migration.
+func checkPath(migrationPath string) string {
+	return strings.TrimSuffix(migrationPath, ".sql") + ".check.sql"
+}
+
+// Add the check file for a migration, if it exists.
+func (s *Schema) addCheckUnit(migrationPath string) error {
+	unitPath := checkPath(migrationPath)
+	if _, err := fs.Stat(s.Package.Source, path.Join(s.Path, unitPath)); err != nil {
+		return nil
+	}
+
+	s.migrationPaths[unitPath] = true
+	if err := s.addUnit(unitPath); err != nil {
+		return err
+	}
+
+	s.checkUnits[migrationPath] = s.Index[unitPath]
 	return nil
 }
 
@@ -78,6 +147,39 @@ func (s *Schema) loadMigrationState(tx *PkgTx) error {
 	}
 
 	s.migrationState = migrationState
+
+	if err := s.loadRepeatableState(tx); err != nil {
+		return err
+	}
+
+	// A package that has never been migrated can be installed from the baseline.
+	s.useBaseline = s.baselinePath != "" && len(migrationState) == 0 && !s.Package.options().IgnoreBaseline
+	return nil
+}
+
+// Load the hashes of the repeatable migrations that have already been run. The hash
+// column doesn't exist until pgpkg has migrated itself, so it's only read for
+// packages that have repeatable migrations.
+func (s *Schema) loadRepeatableState(tx *PkgTx) error {
+	repeatableState := make(map[string]string)
+
+	if len(s.repeatableIndex) > 0 && !s.Package.bootstrapSchema {
+		repeatables, err := tx.Query("select path, hash from pgpkg.migration where pkg=$1 and hash is not null", s.Package.Name)
+		if err != nil {
+			return fmt.Errorf("unable to get repeatable migration status: %w", err)
+		}
+
+		for repeatables.Next() {
+			var path, hash string
+			if err = repeatables.Scan(&path, &hash); err != nil {
+				return fmt.Errorf("unexpected error: %w", err)
+			}
+
+			repeatableState[path] = hash
+		}
+	}
+
+	s.repeatableState = repeatableState
 	return nil
 }
 
@@ -88,6 +190,14 @@ func (s *Schema) saveMigrationState(tx *PkgTx) error {
 			return fmt.Errorf("unable to save migration state: %w", err)
 		}
 	}
+
+	for path, hash := range s.repeatedState {
+		if _, err := tx.Exec("insert into pgpkg.migration (pkg, path, hash) values ($1, $2, $3) "+
+			"on conflict (pkg, path) do update set hash=excluded.hash", s.Package.Name, path, hash); err != nil {
+			return fmt.Errorf("unable to save repeatable migration state: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -102,6 +212,12 @@ func (s *Schema) Apply(tx *PkgTx) error {
 	// keep track of the migrations performed, by name.
 	migratedState := make(map[string]bool)
 
+	if s.useBaseline {
+		if err = s.applyBaseline(tx, migratedState); err != nil {
+			return err
+		}
+	}
+
 	for _, migrationPath := range s.migrationIndex {
 		unitPath := path.Join(s.migrationDir, migrationPath)
 
@@ -109,15 +225,21 @@ func (s *Schema) Apply(tx *PkgTx) error {
 		// refactor and reorganise their file tree without worrying.
 		migrationName := filepath.Base(unitPath)
 
-		if !s.migrationState[migrationName] {
-			unit, ok := s.getUnit(unitPath)
-			if !ok {
-				return fmt.Errorf("error: unit not found: %s", unitPath)
-			}
-
-			err = s.ApplyUnit(tx, unit)
-			if err != nil {
-				return err
+		if !s.migrationState[migrationName] && !migratedState[migrationName] {
+			if fn, ok := s.Package.migrationFuncs[migrationPath]; ok {
+				if err = s.applyFunc(tx, migrationPath, fn); err != nil {
+					return err
+				}
+			} else {
+				unit, ok := s.getUnit(unitPath)
+				if !ok {
+					return fmt.Errorf("error: unit not found: %s", unitPath)
+				}
+
+				err = s.ApplyUnit(tx, unit)
+				if err != nil {
+					return err
+				}
 			}
 
 			s.Package.StatMigrationCount++
@@ -127,6 +249,114 @@ func (s *Schema) Apply(tx *PkgTx) error {
 
 	s.migratedState = migratedState
 
+	return s.applyRepeatables(tx)
+}
+
+// goMigration identifies a Go migration in error messages.
+type goMigration struct {
+	pkg  *Package
+	name string
+}
+
+func (g *goMigration) Location() string {
+	return g.pkg.Location + ":" + g.name
+}
+
+func (g *goMigration) DefaultContext() *PKGErrorContext {
+	return nil
+}
+
+// applyFunc runs a migration that was registered with Package.RegisterMigration.
+func (s *Schema) applyFunc(tx *PkgTx, name string, fn MigrationFunc) error {
+	if s.Package.options().Verbose {
+		Verbose.Printf("%s: running Go migration %s\n", s.Package.Name, name)
+	}
+
+	if err := fn(tx.Context(), tx); err != nil {
+		return fmt.Errorf("unable to upgrade schema: %w",
+			PKGErrorf(&goMigration{pkg: s.Package, name: name}, err, "Go migration failed"))
+	}
+
+	return nil
+}
+
+// hasMigrations indicates if the schema has any migrations, including Go migrations
+// which don't have a unit.
+func (s *Schema) hasMigrations() bool {
+	return s.HasUnits() || len(s.migrationIndex) > 0
+}
+
+// hasMigration indicates if the named migration appears in the migration index.
+func (s *Schema) hasMigration(name string) bool {
+	for _, migrationPath := range s.migrationIndex {
+		if migrationPath == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyRepeatables runs each repeatable migration whose contents have changed since
+// it was last run. Repeatable migrations are run in order, after the other migrations.
+func (s *Schema) applyRepeatables(tx *PkgTx) error {
+	repeatedState := make(map[string]string)
+
+	for _, repeatablePath := range s.repeatableIndex {
+		unit, ok := s.getUnit(repeatablePath)
+		if !ok {
+			return fmt.Errorf("error: unit not found: %s", repeatablePath)
+		}
+
+		hash, err := unit.Hash()
+		if err != nil {
+			return err
+		}
+
+		repeatableName := filepath.Base(repeatablePath)
+		if s.repeatableState[repeatableName] == hash {
+			continue
+		}
+
+		if err = s.ApplyUnit(tx, unit); err != nil {
+			return err
+		}
+
+		s.Package.StatMigrationCount++
+		repeatedState[repeatableName] = hash
+	}
+
+	s.repeatedState = repeatedState
+	return nil
+}
+
+// applyBaseline runs the baseline script in place of the migrations it covers, and marks
+// those migrations (and the baseline itself) as migrated.
+func (s *Schema) applyBaseline(tx *PkgTx, migratedState map[string]bool) error {
+	if s.Package.options().Verbose {
+		Verbose.Printf("%s: fresh install; using baseline %s\n", s.Package.Name, s.baselinePath)
+	}
+
+	unit, ok := s.getUnit(s.baselinePath)
+	if !ok {
+		return fmt.Errorf("error: unit not found: %s", s.baselinePath)
+	}
+
+	if err := s.ApplyUnit(tx, unit); err != nil {
+		return err
+	}
+
+	s.Package.StatMigrationCount++
+	migratedState[filepath.Base(s.baselinePath)] = true
+
+	for _, migrationPath := range s.migrationIndex {
+		migrationName := filepath.Base(migrationPath)
+		migratedState[migrationName] = true
+		if migrationName == s.baselineThrough {
+			break
+		}
+	}
+
 	return nil
 }
 
@@ -150,10 +380,90 @@ func (s *Schema) loadMigrations(migrations []string) error {
 		}
 		uniqueNameMap[migrationName] = true
 
+		// Go migrations don't have a file.
+		if _, ok := s.Package.migrationFuncs[path]; ok {
+			continue
+		}
+
 		s.migrationPaths[path] = true
 		if err := s.addUnit(path); err != nil {
 			return err
 		}
+
+		if err := s.addCheckUnit(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load the baseline script, which can be used instead of the migrations it covers
+// when a package is installed for the first time. through names the last migration
+// covered by the baseline; if empty, the baseline covers all migrations.
+func (s *Schema) loadBaseline(baseline string, through string) error {
+	if s.migrationDir != "." {
+		return fmt.Errorf("a Baseline can only be used with the Migrations clause in pgpkg.toml")
+	}
+
+	baselineName := filepath.Base(baseline)
+	throughFound := through == ""
+
+	for _, migrationPath := range s.migrationIndex {
+		migrationName := filepath.Base(migrationPath)
+		if migrationName == baselineName {
+			return fmt.Errorf("baseline name '%s' is also used by migration %s", baselineName, migrationPath)
+		}
+
+		if migrationName == through {
+			throughFound = true
+		}
+	}
+
+	if !throughFound {
+		return fmt.Errorf("BaselineThrough migration '%s' not found in Migrations", through)
+	}
+
+	s.baselinePath = baseline
+	s.baselineThrough = through
+	s.migrationPaths[baseline] = true
+	if err := s.addUnit(baseline); err != nil {
+		return err
+	}
+
+	return s.addCheckUnit(baseline)
+}
+
+// Load the repeatable migrations, based on the config file. Like other migrations,
+// repeatable migrations are identified by their filename, which must be unique.
+func (s *Schema) loadRepeatables(repeatables []string) error {
+	uniqueNameMap := make(map[string]bool)
+
+	for _, migrationPath := range s.migrationIndex {
+		uniqueNameMap[filepath.Base(migrationPath)] = true
+	}
+
+	if s.baselinePath != "" {
+		uniqueNameMap[filepath.Base(s.baselinePath)] = true
+	}
+
+	s.repeatableIndex = repeatables
+
+	for _, path := range repeatables {
+		repeatableName := filepath.Base(path)
+		if uniqueNameMap[repeatableName] {
+			return fmt.Errorf("duplicate migration name '%s' found in path %s", repeatableName, path)
+		}
+		uniqueNameMap[repeatableName] = true
+
+		s.migrationPaths[path] = true
+		if err := s.addUnit(path); err != nil {
+			return err
+		}
+
+		if err := s.addCheckUnit(path); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -201,6 +511,15 @@ func (s *Schema) loadMigrationDir(migrationDir string) error {
 			return nil
 		}
 
+		// Check files belong to the migration with the same name.
+		if strings.HasSuffix(relPath, ".check.sql") && migrationSet[strings.TrimSuffix(relPath, ".check.sql")+".sql"] {
+			if err := s.addUnit(path); err != nil {
+				return err
+			}
+			s.checkUnits[strings.TrimSuffix(path, ".check.sql")+".sql"] = s.Index[path]
+			return nil
+		}
+
 		if !migrationSet[relPath] {
 			return fmt.Errorf("warning: %s: not found in %s/%s", relPath, migrationDir, migrationFilename)
 		}
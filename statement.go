@@ -1,6 +1,8 @@
 package pgpkg
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/lib/pq"
 	pg_query "github.com/pganalyze/pg_query_go/v6"
@@ -70,6 +72,13 @@ func (s *Statement) Try(tx *PkgTx) (bool, error) {
 	return true, nil
 }
 
+// sourceHash returns a hash of the statement's source, which is used to detect changes
+// to managed objects.
+func (s *Statement) sourceHash() string {
+	sum := sha256.Sum256([]byte(s.Source))
+	return hex.EncodeToString(sum[:])
+}
+
 // Headline returns the first line of the statement, eg, to provide context
 // during debugging and logging.
 func (s *Statement) Headline() string {
@@ -2,9 +2,13 @@ package pgpkg
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // These functions create and destroy tempoarary databases.
@@ -29,6 +33,19 @@ func MkTempDbName() string {
 // We do this by connecting to the database using the environment,
 // and running "create database". We return the database name.
 func CreateTempDB(dsn string) (string, error) {
+	return CreateTempDBFrom(dsn, "")
+}
+
+// How many times, and how often, copying a template database is attempted while the template is in use.
+const (
+	templateCopyAttempts = 40
+	templateCopyDelay    = 250 * time.Millisecond
+)
+
+// CreateTempDBFrom creates a temporary database with a random name, as a copy of
+// the template database. If the template is in use, the copy is retried for up to ten seconds.
+// If template is empty, the server's default template is used. We return the database name.
+func CreateTempDBFrom(dsn string, template string) (string, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return "", fmt.Errorf("unable to open database: %w", err)
@@ -37,8 +54,25 @@ func CreateTempDB(dsn string) (string, error) {
 	// important: ensure that the dbname only ever contains alphanumeric characters
 	dbname := "pgpkg." + MkTempDbName()
 	mkdbcmd := fmt.Sprintf("create database \"%s\"", dbname)
-	_, err = db.Exec(mkdbcmd)
+	if template != "" {
+		mkdbcmd = mkdbcmd + " template " + pq.QuoteIdentifier(template)
+	}
+
+	// Copying a database fails if anyone else is connected to it, including another session which
+	// is copying it at the same time, so the copy is retried for a while.
+	for attempt := 1; ; attempt++ {
+		_, err = db.Exec(mkdbcmd)
+
+		var pqErr *pq.Error
+		if template == "" || attempt == templateCopyAttempts || !errors.As(err, &pqErr) || pqErr.Code != "55006" {
+			break
+		}
+
+		time.Sleep(templateCopyDelay)
+	}
+
 	if err != nil {
+		_ = db.Close()
 		return "", fmt.Errorf("unable to create temp database \"%s\": %w", dbname, err)
 	}
 
@@ -52,15 +86,23 @@ func CreateTempDB(dsn string) (string, error) {
 // DropTempDB drops the given database. WARNING: it will actually drop any database
 // you ask it to, so take care only to use the database created by CreateTempDb
 func DropTempDB(dsn string, dbname string) error {
+	return dropTempDB(dsn, dbname, false)
+}
+
+// ForceDropTempDB drops the given database, as with DropTempDB, but first disconnects any sessions
+// that are still using it (such as a psql session that hasn't quite exited).
+func ForceDropTempDB(dsn string, dbname string) error {
+	return dropTempDB(dsn, dbname, true)
+}
+
+func dropTempDB(dsn string, dbname string, force bool) error {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return fmt.Errorf("unable to open database: %w", err)
 	}
 
-	// important: ensure that the dbname only ever contains alphanumeric characters
-	mkdbcmd := fmt.Sprintf("drop database \"%s\"", dbname)
-	_, err = db.Exec(mkdbcmd)
-	if err != nil {
+	if err = dropDatabase(db, dbname, force); err != nil {
+		_ = db.Close()
 		return fmt.Errorf("unable to drop temp database \"%s\": %w", dbname, err)
 	}
 
@@ -71,9 +113,135 @@ func DropTempDB(dsn string, dbname string) error {
 	return nil
 }
 
+// Drop a database. If force is set, any sessions using the database are disconnected first.
+func dropDatabase(db *sql.DB, dbname string, force bool) error {
+	dropCmd := "drop database " + pq.QuoteIdentifier(dbname)
+	if !force {
+		_, err := db.Exec(dropCmd)
+		return err
+	}
+
+	var version int
+	if err := db.QueryRow("select current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return err
+	}
+
+	// "with (force)" was added in PostgreSQL 13. Older servers disconnect the sessions first,
+	// but a new session could still connect before the database is dropped.
+	if version >= 130000 {
+		_, err := db.Exec(dropCmd + " with (force)")
+		return err
+	}
+
+	if _, err := db.Exec("select pg_terminate_backend(pid) from pg_stat_activity where datname = $1 and pid <> pg_backend_pid()", dbname); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(dropCmd)
+	return err
+}
+
+// DropTempDBs drops each of the given databases which exist. This is used to clean up after
+// a parallel test run, including one that was interrupted.
+// WARNING: like DropTempDB, it will drop any database you ask it to.
+func DropTempDBs(dsn string, dbnames []string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var dropErrs []error
+	for _, dbname := range dbnames {
+		if _, err = db.Exec("drop database if exists " + pq.QuoteIdentifier(dbname)); err != nil {
+			dropErrs = append(dropErrs, fmt.Errorf("unable to drop temp database \"%s\": %w", dbname, err))
+		}
+	}
+
+	return errors.Join(dropErrs...)
+}
+
+// tempDBPattern matches the names of databases created by CreateTempDB.
+const tempDBPattern = `^pgpkg\.[a-z]{8}$`
+
+// DropAllTempDBs drops the temporary databases created by CreateTempDB which have been left behind,
+// for example by --keep-db-on-failure, or by a pgpkg process that didn't exit cleanly. Databases
+// which are in use, for example by a running pgpkg test or pgpkg repl, are skipped unless force is
+// set. Template databases aren't affected; see DropTemplateDBs.
+//
+// Returns the names of the databases that were dropped, and of those that were skipped.
+func DropAllTempDBs(dsn string, force bool) ([]string, []string, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("select d.datname, exists (select 1 from pg_stat_activity a where a.datname = d.datname) "+
+		"from pg_database d where d.datname ~ $1 order by d.datname", tempDBPattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list temp databases: %w", err)
+	}
+
+	var dbnames, inUse []string
+	for rows.Next() {
+		var dbname string
+		var active bool
+		if err = rows.Scan(&dbname, &active); err != nil {
+			_ = rows.Close()
+			return nil, nil, fmt.Errorf("unable to list temp databases: %w", err)
+		}
+
+		if active && !force {
+			inUse = append(inUse, dbname)
+		} else {
+			dbnames = append(dbnames, dbname)
+		}
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, nil, fmt.Errorf("unable to list temp databases: %w", err)
+	}
+
+	// Without force, a database which is connected to after it was listed can't be dropped.
+	for i, dbname := range dbnames {
+		if err = dropDatabase(db, dbname, force); err != nil {
+			return dbnames[:i], inUse, fmt.Errorf("unable to drop temp database \"%s\": %w", dbname, err)
+		}
+	}
+
+	return dbnames, inUse, nil
+}
+
 func DropTempDBOrExit(dsn string, replDb string) {
 	if err := DropTempDB(dsn, replDb); err != nil {
 		fmt.Fprintf(os.Stderr, "unable to drop REPL database %s: %v\n", replDb, err)
 		os.Exit(1)
 	}
 }
+
+// SeedTempDB runs the SQL script at the given path in the database. This is used to load
+// data into a temporary database before it's upgraded, so that migrations are tested
+// against something like real data. The script can contain multiple statements.
+func SeedTempDB(dsn string, path string) error {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read seed script: %w", err)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("unable to open database: %w", err)
+	}
+
+	if _, err = db.Exec(string(script)); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("unable to run seed script %s: %w", path, err)
+	}
+
+	if err = db.Close(); err != nil {
+		return fmt.Errorf("unable to close database: %w", err)
+	}
+
+	return nil
+}
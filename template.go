@@ -0,0 +1,232 @@
+package pgpkg
+
+// Building a project from scratch replays every migration, which can be slow. Template databases
+// keep the result of a build, so that temporary databases for "pgpkg test" and "pgpkg repl" can be
+// created as copies of the template instead. Each template is named after a hash of everything
+// that went into building it, so a template is only reused if the project hasn't changed.
+//
+// Each template is labelled with the project it was built for. When a new template is built, the
+// project's previous templates are dropped; use DropTemplateDBs to remove all of them.
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// TemplateDBPrefix is the prefix of the names of template databases.
+const TemplateDBPrefix = "pgpkg.tpl."
+
+var templateKeyPattern = regexp.MustCompile("^[0-9a-f]{16,}$")
+
+// Add the contents of each file in an FS to a hash, in path order. Hidden directories, such as
+// the package cache, are skipped; dependencies in the cache are hashed as packages in their own right.
+func hashFS(h io.Writer, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if filePath != "." && d.Name()[0] == '.' {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		contents, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00", filePath, len(contents))
+		_, _ = h.Write(contents)
+		return nil
+	})
+}
+
+// SourceHash returns a hash of the sources of every package in the project, including its
+// dependencies, and of pgpkg itself. Options which change how the project is built are also
+// included. Two projects with the same hash build the same database.
+func (p *Project) SourceHash() (string, error) {
+	if err := p.resolveDependencies(); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "ignore-baseline=%t\x00force-role=%s\x00", p.options().IgnoreBaseline, p.options().ForceRole)
+
+	if err := hashFS(h, pgpkgFS); err != nil {
+		return "", fmt.Errorf("unable to hash pgpkg: %w", err)
+	}
+
+	pkgNames := make([]string, 0, len(p.pkgs))
+	for pkgName := range p.pkgs {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+
+	for _, pkgName := range pkgNames {
+		_, _ = fmt.Fprintf(h, "package\x00%s\x00", pkgName)
+		if err := hashFS(h, p.pkgs[pkgName].Source); err != nil {
+			return "", fmt.Errorf("unable to hash package %s: %w", pkgName, err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// TemplateDB returns the name of the template database identified by key, which must be a
+// hex string such as the result of SourceHash. If the template doesn't exist, it's created by
+// calling build with the DSN of an empty database. The template is only created if build succeeds.
+//
+// The label identifies the project, and how it was built. Once a new template has been created,
+// any other templates with the same label are dropped, unless they are in use.
+func (p *Project) TemplateDB(dsn string, label string, key string, build func(buildDSN string) error) (string, error) {
+	// important: ensure that the dbname only ever contains alphanumeric characters
+	if !templateKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("illegal template key: %s", key)
+	}
+
+	dbname := TemplateDBPrefix + key[:16]
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return "", fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err = db.QueryRow("select exists (select 1 from pg_database where datname = $1)", dbname).Scan(&exists); err != nil {
+		return "", fmt.Errorf("unable to find template database: %w", err)
+	}
+
+	if exists {
+		if p.options().Verbose {
+			Verbose.Printf("using template database %s\n", dbname)
+		}
+		return dbname, nil
+	}
+
+	// Build the template under a temporary name, and rename it once it's complete, so that
+	// a failed or interrupted build is never used.
+	buildName, err := CreateTempDB(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	if err = build(dsn + " dbname=" + buildName); err != nil {
+		return "", errors.Join(err, DropTempDB(dsn, buildName))
+	}
+
+	if _, err = db.Exec(fmt.Sprintf("comment on database \"%s\" is %s", buildName, pq.QuoteLiteral(label))); err != nil {
+		return "", errors.Join(fmt.Errorf("unable to label template database: %w", err), DropTempDB(dsn, buildName))
+	}
+
+	_, err = db.Exec(fmt.Sprintf("alter database \"%s\" rename to \"%s\"", buildName, dbname))
+	if err != nil {
+		dropErr := DropTempDB(dsn, buildName)
+
+		// Someone else built the same template at the same time.
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "42P04" {
+			return dbname, dropErr
+		}
+
+		return "", errors.Join(fmt.Errorf("unable to create template database %s: %w", dbname, err), dropErr)
+	}
+
+	if p.options().Verbose {
+		Verbose.Printf("created template database %s\n", dbname)
+	}
+
+	p.dropPreviousTemplates(db, label, dbname)
+	return dbname, nil
+}
+
+// Drop the templates which have the same label as the template dbname. Templates which are in use
+// (for example, while another pgpkg process is copying one) are left alone, and dropped next time.
+// Failing to drop a template doesn't stop the new template being used, so errors are only reported.
+func (p *Project) dropPreviousTemplates(db *sql.DB, label string, dbname string) {
+	rows, err := db.Query("select datname from pg_database "+
+		"where starts_with(datname, $1) and datname <> $2 and shobj_description(oid, 'pg_database') = $3",
+		TemplateDBPrefix, dbname, label)
+	if err != nil {
+		Stderr.Printf("warning: unable to find previous template databases: %v\n", err)
+		return
+	}
+
+	var dbnames []string
+	for rows.Next() {
+		var previous string
+		if err = rows.Scan(&previous); err != nil {
+			_ = rows.Close()
+			Stderr.Printf("warning: unable to find previous template databases: %v\n", err)
+			return
+		}
+		dbnames = append(dbnames, previous)
+	}
+	_ = rows.Close()
+
+	for _, previous := range dbnames {
+		err = dropDatabase(db, previous, false)
+
+		var pqErr *pq.Error
+		switch {
+		case err == nil:
+			if p.options().Verbose {
+				Verbose.Printf("dropped previous template database %s\n", previous)
+			}
+		case errors.As(err, &pqErr) && pqErr.Code == "55006":
+			if p.options().Verbose {
+				Verbose.Printf("previous template database %s is in use; not dropped\n", previous)
+			}
+		default:
+			Stderr.Printf("warning: unable to drop previous template database %s: %v\n", previous, err)
+		}
+	}
+}
+
+// DropTemplateDBs drops every template database, and returns the names of the databases that were dropped.
+func DropTemplateDBs(dsn string) ([]string, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("select datname from pg_database where starts_with(datname, $1) order by datname", TemplateDBPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list template databases: %w", err)
+	}
+
+	var dbnames []string
+	for rows.Next() {
+		var dbname string
+		if err = rows.Scan(&dbname); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("unable to list template databases: %w", err)
+		}
+		dbnames = append(dbnames, dbname)
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("unable to list template databases: %w", err)
+	}
+
+	for i, dbname := range dbnames {
+		if _, err = db.Exec("drop database " + pq.QuoteIdentifier(dbname)); err != nil {
+			return dbnames[:i], fmt.Errorf("unable to drop template database \"%s\": %w", dbname, err)
+		}
+	}
+
+	return dbnames, nil
+}
@@ -0,0 +1,39 @@
+package pgpkg
+
+import (
+	"testing"
+)
+
+func TestSourceHash(t *testing.T) {
+	hash := func(pkgPath string) string {
+		p, err := NewProjectFrom(pkgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := p.SourceHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	first := hash("tests/good/passing-tests")
+	if !templateKeyPattern.MatchString(first) {
+		t.Fatalf("source hash is not a valid template key: %s", first)
+	}
+
+	if second := hash("tests/good/passing-tests"); second != first {
+		t.Errorf("source hash is not stable: %s, %s", first, second)
+	}
+
+	if other := hash("tests/good/objects"); other == first {
+		t.Errorf("different projects have the same source hash")
+	}
+
+	Options.IgnoreBaseline = true
+	defer func() { Options.IgnoreBaseline = false }()
+	if ignored := hash("tests/good/passing-tests"); ignored == first {
+		t.Errorf("source hash does not depend on --ignore-baseline")
+	}
+}
@@ -0,0 +1,241 @@
+package pgpkg
+
+// Test reports record the result of every test in a machine-readable format, for use by CI
+// systems. Reports are requested with --test-report=junit:<path> or --test-report=tap[:<path>];
+// TAP reports are written to stdout if no path is given.
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	testReportJUnit = "junit"
+	testReportTAP   = "tap"
+)
+
+// TestResult records the outcome of a single test.
+type TestResult struct {
+	Package  string        // name of the package containing the test
+	Unit     string        // path of the file declaring the test
+	Name     string        // name of the test function
+	Duration time.Duration // how long the test took to run
+	Skipped  bool          // the test was excluded, and didn't run
+	Err      error         // why the test failed, or nil if it passed
+}
+
+// Failed indicates if the test failed.
+func (r *TestResult) Failed() bool {
+	return r.Err != nil
+}
+
+// Stack returns the location of each frame of the error context, one per line.
+func (r *TestResult) Stack() string {
+	var pkgErr *PKGError
+	if !errors.As(r.Err, &pkgErr) {
+		return ""
+	}
+
+	var stack []string
+	for c := pkgErr.GetContext(); c != nil; c = c.Next {
+		if c.LineNumber > 0 {
+			stack = append(stack, fmt.Sprintf("%s:%d", c.Location, c.LineNumber))
+		} else {
+			stack = append(stack, c.Location)
+		}
+	}
+
+	return strings.Join(stack, "\n")
+}
+
+// A test report requested on the command line.
+type testReport struct {
+	format string
+	path   string // "" means stdout
+}
+
+// Parse a --test-report option, which has the form "format[:path]".
+func parseTestReport(value string) (testReport, error) {
+	format, reportPath, _ := strings.Cut(value, ":")
+	report := testReport{format: format, path: reportPath}
+
+	switch format {
+	case testReportJUnit:
+		if reportPath == "" {
+			return report, fmt.Errorf("JUnit test reports need a path: --test-report=junit:<path>")
+		}
+	case testReportTAP:
+	default:
+		return report, fmt.Errorf("unknown test report format %s; use junit or tap", format)
+	}
+
+	return report, nil
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Stack   string `xml:",chardata"`
+}
+
+type junitSkipped struct{}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name          `xml:"testsuites"`
+	Suites  []*junitTestSuite `xml:"testsuite"`
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// Write test results as JUnit XML, with one test suite per package.
+func writeJUnit(w io.Writer, results []*TestResult) error {
+	report := &junitTestSuites{}
+	suites := make(map[string]*junitTestSuite)
+	durations := make(map[string]time.Duration)
+
+	for _, r := range results {
+		suite, ok := suites[r.Package]
+		if !ok {
+			suite = &junitTestSuite{Name: r.Package}
+			suites[r.Package] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+
+		testCase := &junitTestCase{Name: r.Name, ClassName: r.Unit, Time: formatSeconds(r.Duration)}
+		switch {
+		case r.Skipped:
+			testCase.Skipped = &junitSkipped{}
+			suite.Skipped++
+		case r.Failed():
+			testCase.Failure = &junitFailure{Message: r.Err.Error(), Stack: r.Stack()}
+			suite.Failures++
+		}
+
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+		durations[r.Package] += r.Duration
+	}
+
+	for _, suite := range report.Suites {
+		suite.Time = formatSeconds(durations[suite.Name])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Write test results in TAP (Test Anything Protocol) version 13 format.
+func writeTAP(w io.Writer, results []*TestResult) error {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(results))
+
+	for i, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(&b, "ok %d - %s # SKIP\n", i+1, r.Name)
+		case r.Failed():
+			fmt.Fprintf(&b, "not ok %d - %s\n", i+1, r.Name)
+			b.WriteString("  ---\n")
+			fmt.Fprintf(&b, "  package: %q\n", r.Package)
+			fmt.Fprintf(&b, "  unit: %q\n", r.Unit)
+			fmt.Fprintf(&b, "  message: %q\n", r.Err.Error())
+			if stack := r.Stack(); stack != "" {
+				b.WriteString("  stack: |\n")
+				for _, line := range strings.Split(stack, "\n") {
+					fmt.Fprintf(&b, "    %s\n", line)
+				}
+			}
+			fmt.Fprintf(&b, "  duration_ms: %d\n", r.Duration.Milliseconds())
+			b.WriteString("  ...\n")
+		default:
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, r.Name)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write a single test report.
+func (tr testReport) write(results []*TestResult) error {
+	write := writeTAP
+	if tr.format == testReportJUnit {
+		write = writeJUnit
+	}
+
+	if tr.path == "" {
+		return write(os.Stdout, results)
+	}
+
+	f, err := os.Create(tr.path)
+	if err != nil {
+		return fmt.Errorf("unable to create test report: %w", err)
+	}
+
+	if err = write(f, results); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to write test report %s: %w", tr.path, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("unable to write test report %s: %w", tr.path, err)
+	}
+
+	return nil
+}
+
+// WriteTestReports writes the test results of the project to each of the test reports
+// requested with --test-report.
+func (p *Project) WriteTestReports() error {
+	return writeTestReports(p.options().TestReports, p.TestResults)
+}
+
+// WriteTestReports writes test results to each of the test reports in options, as requested with --test-report.
+// This is used to report the results of several projects at once, such as when tests are run in parallel.
+func WriteTestReports(options *OptionSet, results []*TestResult) error {
+	return writeTestReports(options.TestReports, results)
+}
+
+func writeTestReports(reports []testReport, results []*TestResult) error {
+	for _, report := range reports {
+		if err := report.write(results); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
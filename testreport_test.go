@@ -0,0 +1,55 @@
+package pgpkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestReports(t *testing.T) {
+	results := []*TestResult{
+		{Package: "example.com/a", Unit: "a_test.sql", Name: "a.one_test()", Duration: 1500 * time.Microsecond},
+		{Package: "example.com/a", Unit: "a_test.sql", Name: "a.two_test()", Err: errors.New("assertion failed")},
+		{Package: "example.com/a", Unit: "b_test.sql", Name: "a.three_test()", Skipped: true},
+	}
+
+	var tap strings.Builder
+	if err := writeTAP(&tap, results); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"1..3\n", "ok 1 - a.one_test()\n", "not ok 2 - a.two_test()\n",
+		"  message: \"assertion failed\"\n", "ok 3 - a.three_test() # SKIP\n"} {
+		if !strings.Contains(tap.String(), want) {
+			t.Errorf("TAP report does not contain %q:\n%s", want, tap.String())
+		}
+	}
+
+	var junit strings.Builder
+	if err := writeJUnit(&junit, results); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`<testsuite name="example.com/a" tests="3" failures="1" skipped="1"`,
+		`<testcase name="a.one_test()" classname="a_test.sql" time="0.002">`, `<failure message="assertion failed">`} {
+		if !strings.Contains(junit.String(), want) {
+			t.Errorf("JUnit report does not contain %q:\n%s", want, junit.String())
+		}
+	}
+}
+
+func TestParseTestReport(t *testing.T) {
+	if _, err := parseTestReport("junit"); err == nil {
+		t.Error("expected JUnit report without a path to fail")
+	}
+
+	if _, err := parseTestReport("html:out.html"); err == nil {
+		t.Error("expected unknown report format to fail")
+	}
+
+	report, err := parseTestReport("tap")
+	if err != nil || report.format != testReportTAP || report.path != "" {
+		t.Errorf("unexpected result for tap: %v, %v", report, err)
+	}
+}
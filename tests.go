@@ -5,30 +5,90 @@ package pgpkg
 // various states so we can report errors and get stack traces.
 //
 // Nothing is overly complex; but it's not as simple as just executing the units directly.
+//
+// Tests are run in this order:
+//
+//   - _before functions, once, before any tests are run;
+//   - _before_file functions, once per test file, before the tests declared in that file;
+//   - _setup functions declared in the same file as the test, before each test;
+//   - the test itself;
+//   - _teardown functions declared in the same file as the test, after each test, even if it fails;
+//   - _after functions, once, after all the tests have been run.
+//
+// By default, functions of the same kind are run in order of their names, and the tests are run in a
+// random order which can be repeated with --test-seed. With --test-order=declared, everything is run
+// in the order it's declared, file by file.
+//
+// The savepoints used are nested in the same way, so the changes made by _before functions
+// are visible to every test, those made by _before_file functions are visible only to the tests
+// in the same file, and those made by _setup functions are visible only to a single test.
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 type Tests struct {
 	*Bundle
-	state       *stmtApplyState
-	NamedTests  map[string]*Statement
-	BeforeTests map[string]*Statement
+	state        *stmtApplyState
+	NamedTests   map[string]*Statement
+	BeforeTests  map[string]*Statement
+	AfterTests   map[string]*Statement
+	Expectations map[string]*testExpectation // errors that tests are expected to raise
+	fixtures     map[*Unit]*unitFixtures     // functions run around the tests in each unit
+
+	// When tests are run in parallel, each worker runs a share of the tests.
+	worker  int
+	workers int
+
+	// If set, each test is passed to the runner instead of being run directly.
+	runner func(test *SQLTest)
+}
+
+// SQLTest is a single SQL test, which is passed to the runner given to Project.RunTestsWith.
+type SQLTest struct {
+	Package string // name of the package containing the test
+	Name    string // name of the test function, qualified by its schema, e.g. "gl.account_create_test"
+
+	run func() error
+	ran bool
+}
+
+// Run runs the test, and returns an error (usually a *PKGError) if it fails.
+// Run must be called before the runner returns, and only once.
+func (st *SQLTest) Run() error {
+	if st.ran {
+		return fmt.Errorf("test %s has already been run", st.Name)
+	}
+
+	st.ran = true
+	return st.run()
+}
+
+// Functions that are run around the tests declared in a single unit.
+type unitFixtures struct {
+	beforeFile []*testStatement
+	setup      []*testStatement
+	teardown   []*testStatement
 }
 
 type TestFunctionType int
 
 const (
-	TestFunctionOther  TestFunctionType = iota // utility function, declared but not executed
-	TestFunctionTest                           // test function, called during testing
-	TestFunctionBefore                         // before function, called once, before tests start.
+	TestFunctionOther      TestFunctionType = iota // utility function, declared but not executed
+	TestFunctionTest                               // test function, called during testing
+	TestFunctionBefore                             // before function, called once, before tests start.
+	TestFunctionAfter                              // after function, called once, after all tests have run.
+	TestFunctionBeforeFile                         // called once, before the tests in the same file are run.
+	TestFunctionSetup                              // called before each test in the same file.
+	TestFunctionTeardown                           // called after each test in the same file.
 )
 
-// Given a function name, is it a test function, a before function, or a utility function?
+// Given a function name, is it a test function, a fixture such as a before function, or a utility function?
 func getTestFunctionType(name string) TestFunctionType {
 	if strings.HasSuffix(name, "_test") {
 		return TestFunctionTest
@@ -39,8 +99,19 @@ func getTestFunctionType(name string) TestFunctionType {
 	}
 
 	if strings.HasSuffix(name, "_after") {
-		_, _ = fmt.Fprintf(os.Stderr, "warning: test name %s is reserved for future use\n", name)
-		return TestFunctionOther
+		return TestFunctionAfter
+	}
+
+	if strings.HasSuffix(name, "_before_file") {
+		return TestFunctionBeforeFile
+	}
+
+	if strings.HasSuffix(name, "_setup") {
+		return TestFunctionSetup
+	}
+
+	if strings.HasSuffix(name, "_teardown") {
+		return TestFunctionTeardown
 	}
 
 	if strings.HasPrefix(name, "test_") {
@@ -56,10 +127,13 @@ func (t *Tests) parse() error {
 
 	namedTests := make(map[string]*Statement)
 	beforeTests := make(map[string]*Statement)
+	afterTests := make(map[string]*Statement)
+	fixtures := make(map[*Unit]*unitFixtures)
+	expectations := make(map[string]*testExpectation)
 	definitions := make(map[string]*Statement)
 
 	for _, u := range t.Units {
-		if Options.Verbose {
+		if t.Package.options().Verbose {
 			Verbose.Println("parsing tests", u.Location())
 		}
 
@@ -67,6 +141,9 @@ func (t *Tests) parse() error {
 			return fmt.Errorf("unable to parse tests: %w", err)
 		}
 
+		unitFixture := &unitFixtures{}
+		fixtures[u] = unitFixture
+
 		for _, stmt := range u.Statements {
 			obj, err := stmt.GetManagedObject()
 			if err != nil {
@@ -106,7 +183,13 @@ func (t *Tests) parse() error {
 
 			testFunctionType := getTestFunctionType(fname)
 
-			if (testFunctionType != TestFunctionOther) && len(obj.ObjectArgs) != 0 {
+			// Fixtures are called without arguments, so functions which take arguments are
+			// utility functions, even if their names look like fixtures.
+			if testFunctionType != TestFunctionTest && len(obj.ObjectArgs) != 0 {
+				testFunctionType = TestFunctionOther
+			}
+
+			if testFunctionType == TestFunctionTest && len(obj.ObjectArgs) != 0 {
 				return PKGErrorf(stmt, nil, "test functions cannot receive arguments: %s %s", obj.ObjectType, obj.ObjectName)
 			}
 
@@ -114,18 +197,44 @@ func (t *Tests) parse() error {
 			case TestFunctionTest:
 				t.Package.StatTestCount++
 				namedTests[obj.ObjectName] = stmt
+
+				expect, err := parseExpectation(stmt, fname)
+				if err != nil {
+					return err
+				}
+				if expect != nil {
+					expectations[obj.ObjectName] = expect
+				}
 			case TestFunctionBefore:
 				beforeTests[obj.ObjectName] = stmt
+			case TestFunctionAfter:
+				afterTests[obj.ObjectName] = stmt
+			case TestFunctionBeforeFile:
+				unitFixture.beforeFile = append(unitFixture.beforeFile, &testStatement{name: obj.ObjectName, stmt: stmt})
+			case TestFunctionSetup:
+				unitFixture.setup = append(unitFixture.setup, &testStatement{name: obj.ObjectName, stmt: stmt})
+			case TestFunctionTeardown:
+				unitFixture.teardown = append(unitFixture.teardown, &testStatement{name: obj.ObjectName, stmt: stmt})
 			default:
 				// do nothing.
 			}
 
 			pending = append(pending, stmt)
 		}
+
 	}
 
 	t.NamedTests = namedTests
 	t.BeforeTests = beforeTests
+	t.AfterTests = afterTests
+	t.fixtures = fixtures
+
+	for _, unitFixture := range fixtures {
+		t.orderFixtures(unitFixture.beforeFile)
+		t.orderFixtures(unitFixture.setup)
+		t.orderFixtures(unitFixture.teardown)
+	}
+	t.Expectations = expectations
 	t.state = &stmtApplyState{pending: pending}
 	return nil
 }
@@ -138,40 +247,120 @@ func (t *Tests) runTest(tx *PkgTx, testName string, testStmt *Statement) error {
 		return fmt.Errorf("unable to begin savepoint for test %s: %w", testName, spErr)
 	}
 
-	cmd := fmt.Sprintf("select %s", testName)
-	_, testErr := tx.Exec(cmd)
+	fixtures := t.fixtures[testStmt.Unit]
+	start := time.Now()
+
+	// The command and error used to find the context of a failure.
+	message := "setup failed for test"
+	cmd, testErr := runFixtures(tx, fixtures.setup)
+	failure := testErr
+
+	if failure == nil {
+		message = "test failed"
+		cmd = fmt.Sprintf("select %s", testName)
+		testErr = runTestBody(tx, cmd, len(fixtures.teardown) > 0)
+
+		// Tests that are expected to raise an error fail if they don't.
+		failure = testErr
+		if expect, ok := t.Expectations[testName]; ok {
+			failure = expect.check(testErr)
+		}
+
+		// Teardown functions are run even if the test failed, but the test's failure is reported first.
+		teardownCmd, teardownErr := runFixtures(tx, fixtures.teardown)
+		if failure == nil && teardownErr != nil {
+			message = "teardown failed for test"
+			cmd, testErr, failure = teardownCmd, teardownErr, teardownErr
+		}
+	}
+
+	duration := time.Since(start)
 
 	_, rberr := tx.Exec("rollback to savepoint unittest")
 	if rberr != nil {
 		panic(rberr)
 	}
 
-	if testErr == nil {
-		if Options.ShowTests {
+	if failure == nil {
+		if t.Package.options().ShowTests {
 			Stdout.Println("  [pass]", testName)
 		}
+		t.record(testName, testStmt, duration, false, nil)
 		return nil
 	}
 
-	if Options.ShowTests {
+	if t.Package.options().ShowTests {
 		Stdout.Println("* [FAIL]", testName)
 	}
 
-	pe := PKGErrorf(testStmt, testErr, "test failed: %s", testName)
+	pe := PKGErrorf(testStmt, failure, "%s: %s", message, testName)
 	pe.Context = getErrorContext(tx, cmd, testErr)
+	t.record(testName, testStmt, duration, false, pe)
 	tx = nil
 	return pe
 }
 
-func (t *Tests) runBefore(tx *PkgTx, beforeName string, beforeStmt *Statement) error {
-	cmd := fmt.Sprintf("select %s", beforeName)
+// Run the body of a test. If the test has teardown functions, it's run in its own savepoint,
+// so that the teardown functions can still be run if it fails.
+func runTestBody(tx *PkgTx, cmd string, nested bool) error {
+	if !nested {
+		_, err := tx.Exec(cmd)
+		return err
+	}
+
+	if _, spErr := tx.Exec("savepoint testbody"); spErr != nil {
+		return fmt.Errorf("unable to begin savepoint for test body: %w", spErr)
+	}
+
+	_, testErr := tx.Exec(cmd)
+	if testErr != nil {
+		if _, rberr := tx.Exec("rollback to savepoint testbody"); rberr != nil {
+			panic(rberr)
+		}
+	}
+
+	return testErr
+}
+
+// Run each of the given setup or teardown functions, stopping at the first error.
+// Returns the failing command and its error.
+func runFixtures(tx *PkgTx, fixtures []*testStatement) (string, error) {
+	for _, fixture := range fixtures {
+		cmd := fmt.Sprintf("select %s", fixture.name)
+		if _, err := tx.Exec(cmd); err != nil {
+			return cmd, err
+		}
+	}
+
+	return "", nil
+}
+
+// Record the result of a test in the project, so it can be included in test reports.
+func (t *Tests) record(testName string, testStmt *Statement, duration time.Duration, skipped bool, err error) {
+	if t.Package.Project == nil {
+		return
+	}
+
+	t.Package.Project.TestResults = append(t.Package.Project.TestResults, &TestResult{
+		Package:  t.Package.Name,
+		Unit:     testStmt.Unit.Path,
+		Name:     testName,
+		Duration: duration,
+		Skipped:  skipped,
+		Err:      err,
+	})
+}
+
+// Run a function which isn't a test, such as a before-function. kind describes the function in error messages.
+func (t *Tests) runHook(tx *PkgTx, kind string, hookName string, hookStmt *Statement) error {
+	cmd := fmt.Sprintf("select %s", hookName)
 	_, testErr := tx.Exec(cmd)
 
 	if testErr == nil {
 		return nil
 	}
 
-	pe := PKGErrorf(beforeStmt, testErr, "before-test script failed: %s", beforeName)
+	pe := PKGErrorf(hookStmt, testErr, "%s script failed: %s", kind, hookName)
 	pe.Context = getErrorContext(tx, cmd, testErr)
 	tx = nil
 	return pe
@@ -182,28 +371,250 @@ type testStatement struct {
 	stmt *Statement
 }
 
-func (t *Tests) getTestStatements() []*testStatement {
-	result := make([]*testStatement, 0, len(t.NamedTests))
-	for name, stmt := range t.NamedTests {
+// Sort test statements by name.
+func sortTestStatements(statements []*testStatement) {
+	sort.Slice(statements, func(i, j int) bool {
+		return statements[i].name < statements[j].name
+	})
+}
+
+// Sort test statements in the order they are declared: by unit, in bundle order, and then by line number.
+func (t *Tests) sortByDeclaration(statements []*testStatement) {
+	unitIndex := make(map[*Unit]int)
+	for i, u := range t.Units {
+		unitIndex[u] = i
+	}
+
+	sort.SliceStable(statements, func(i, j int) bool {
+		si, sj := statements[i].stmt, statements[j].stmt
+		if si.Unit != sj.Unit {
+			return unitIndex[si.Unit] < unitIndex[sj.Unit]
+		}
+		return si.LineNumber < sj.LineNumber
+	})
+}
+
+// Order before-functions and other fixtures. These are run in declaration order with
+// --test-order=declared, and in order of their names otherwise.
+func (t *Tests) orderFixtures(statements []*testStatement) {
+	if t.Package.options().testOrder() == testOrderDeclared {
+		t.sortByDeclaration(statements)
+	} else {
+		sortTestStatements(statements)
+	}
+}
+
+// Convert a map of named statements into a slice, in fixture order.
+func (t *Tests) orderedFixtures(named map[string]*Statement) []*testStatement {
+	result := make([]*testStatement, 0, len(named))
+	for name, stmt := range named {
 		result = append(result, &testStatement{
 			name: name,
 			stmt: stmt,
 		})
 	}
 
-	if Options.SortTests {
-		sort.Slice(result, func(i, j int) bool {
-			return result[i].name < result[j].name
+	t.orderFixtures(result)
+	return result
+}
+
+// Get the tests, grouped by the unit they are declared in, in the order they should be run.
+// With random ordering, both the units and the tests within them are shuffled using the test seed.
+func (t *Tests) getTestStatements() [][]*testStatement {
+	byUnit := make(map[*Unit][]*testStatement)
+	for name, stmt := range t.NamedTests {
+		byUnit[stmt.Unit] = append(byUnit[stmt.Unit], &testStatement{
+			name: name,
+			stmt: stmt,
 		})
 	}
 
+	order := t.Package.options().testOrder()
+	var shuffle *rand.Rand
+	if order == testOrderRandom {
+		shuffle = rand.New(rand.NewSource(t.Package.options().testSeed()))
+	}
+
+	var result [][]*testStatement
+	for _, u := range t.Units {
+		tests, ok := byUnit[u]
+		if !ok {
+			continue
+		}
+
+		switch order {
+		case testOrderDeclared:
+			t.sortByDeclaration(tests)
+		default:
+			// Random ordering starts from sorted tests, so that the seed determines the order.
+			sortTestStatements(tests)
+			if shuffle != nil {
+				shuffle.Shuffle(len(tests), func(i, j int) { tests[i], tests[j] = tests[j], tests[i] })
+			}
+		}
+
+		result = append(result, tests)
+	}
+
+	if shuffle != nil {
+		shuffle.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	}
+
+	if t.workers > 1 {
+		result = t.workerShare(result)
+	}
+
+	return result
+}
+
+// Select this worker's share of the tests, which are dealt out in turn to each worker.
+// The tests remain grouped by unit.
+func (t *Tests) workerShare(groups [][]*testStatement) [][]*testStatement {
+	var result [][]*testStatement
+	next := 0
+
+	for _, tests := range groups {
+		var share []*testStatement
+		for _, test := range tests {
+			if next%t.workers == t.worker {
+				share = append(share, test)
+			}
+			next++
+		}
+
+		if share != nil {
+			result = append(result, share)
+		}
+	}
+
 	return result
 }
 
+// Is the test excluded by --include-tests or --exclude-tests?
+func (t *Tests) isTestSkipped(testName string) bool {
+	if t.Package.options().IncludePattern != nil && !t.Package.options().IncludePattern.MatchString(testName) {
+		return true
+	}
+
+	return t.Package.options().ExcludePattern != nil && t.Package.options().ExcludePattern.MatchString(testName)
+}
+
+// The results of a test run.
+type testSummary struct {
+	passed   int
+	failed   int
+	skipped  int
+	failures []*PKGError // failures to be returned; failures reported to a runner aren't included
+}
+
+// Run the tests declared in a single unit. The unit's _before_file functions are run first, in a
+// savepoint which is rolled back once all the unit's tests have run.
+func (t *Tests) runUnitTests(tx *PkgTx, tests []*testStatement, summary *testSummary) error {
+	var selected []*testStatement
+	for _, test := range tests {
+		if t.isTestSkipped(test.name) {
+			if t.Package.options().ShowSkipped {
+				Stdout.Println("- [skip]", test.name)
+			}
+			t.record(test.name, test.stmt, 0, true, nil)
+			summary.skipped++
+			continue
+		}
+
+		selected = append(selected, test)
+	}
+
+	if len(selected) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec("savepoint testfile"); err != nil {
+		return fmt.Errorf("unable to begin savepoint for test file: %w", err)
+	}
+
+	defer func() {
+		if _, rberr := tx.Exec("rollback to savepoint testfile"); rberr != nil {
+			panic(rberr)
+		}
+	}()
+
+	for _, before := range t.fixtures[selected[0].stmt.Unit].beforeFile {
+		if err := t.runHook(tx, "before-file", before.name, before.stmt); err != nil {
+			return err
+		}
+	}
+
+	for _, test := range selected {
+		if t.runner != nil {
+			if err := t.runWith(tx, test, summary); err != nil {
+				return err
+			}
+		} else if err := t.runTest(tx, test.name, test.stmt); err != nil {
+			pe, ok := err.(*PKGError)
+			if !ok {
+				return err
+			}
+
+			summary.failed++
+			summary.failures = append(summary.failures, pe)
+		} else {
+			summary.passed++
+		}
+
+		if t.Package.options().FailFast && summary.failed > 0 {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Pass a test to the runner, which runs it and reports the result. Test failures are reported
+// by the runner, so they are counted but not returned. Tests which the runner doesn't run are skipped.
+func (t *Tests) runWith(tx *PkgTx, test *testStatement, summary *testSummary) error {
+	var testErr error
+	sqlTest := &SQLTest{
+		Package: t.Package.Name,
+		Name:    sqlTestName(test.name),
+		run: func() error {
+			testErr = t.runTest(tx, test.name, test.stmt)
+			return testErr
+		},
+	}
+
+	t.runner(sqlTest)
+
+	switch {
+	case !sqlTest.ran:
+		t.record(test.name, test.stmt, 0, true, nil)
+		summary.skipped++
+	case testErr == nil:
+		summary.passed++
+	default:
+		if _, ok := testErr.(*PKGError); !ok {
+			return testErr
+		}
+		summary.failed++
+	}
+
+	return nil
+}
+
+// Get the name of a test as it's shown to a runner, which is the name of the test function,
+// qualified by its schema, without quotes or arguments. e.g. "gl"."account_create_test"()
+// becomes gl.account_create_test.
+func sqlTestName(testName string) string {
+	if argIndex := strings.IndexRune(testName, '('); argIndex >= 0 {
+		testName = testName[:argIndex]
+	}
+
+	return strings.ReplaceAll(testName, "\"", "")
+}
+
 func (t *Tests) Run(tx *PkgTx) error {
 
 	// Rollback, and return either the error or an error from the rollback.
-	if !Options.KeepTestScripts {
+	if !t.Package.options().KeepTestScripts {
 		defer func() {
 			if tx != nil {
 				_, rberr := tx.Exec("rollback to savepoint test")
@@ -217,7 +628,7 @@ func (t *Tests) Run(tx *PkgTx) error {
 	// Create a savepoint for the entire set of tests. This savepoint ensures that the
 	// test scripts are removed after testing is complete.
 	// Note that there is a separate savepoint for the individual tests.
-	if !Options.KeepTestScripts {
+	if !t.Package.options().KeepTestScripts {
 		_, err := tx.Exec("savepoint test")
 		if err != nil {
 			return fmt.Errorf("unable to begin test savepoint: %w", err)
@@ -238,37 +649,104 @@ func (t *Tests) Run(tx *PkgTx) error {
 	// Run the before-tests. These are run in this outer savepoint so the results are
 	// available to all the tests within. Note that before-functions are global, not just limited
 	// to the current file.
-	for beforeName, beforeStmt := range t.BeforeTests {
-		if err = t.runBefore(tx, beforeName, beforeStmt); err != nil {
+	for _, before := range t.orderedFixtures(t.BeforeTests) {
+		if err = t.runHook(tx, "before-test", before.name, before.stmt); err != nil {
 			return err
 		}
 	}
 
-	// Run the actual tests.
-	for _, test := range t.getTestStatements() {
-		if Options.IncludePattern != nil {
-			if !Options.IncludePattern.MatchString(test.name) {
-				if Options.ShowSkipped {
-					Stdout.Println("- [skip]", test.name)
-				}
-				continue
-			}
+	// Run the actual tests. Every test is run, unless --fail-fast is set; the first failure is
+	// returned, with the others attached. The seed is printed so that a random order can be repeated.
+	if t.Package.options().testOrder() == testOrderRandom && len(t.NamedTests) > 0 && t.worker == 0 {
+		Stdout.Printf("%s: running tests in random order; use --test-seed=%d to repeat\n", t.Package.Name, t.Package.options().testSeed())
+	}
+
+	summary := &testSummary{}
+	for _, tests := range t.getTestStatements() {
+		if err = t.runUnitTests(tx, tests, summary); err != nil {
+			return err
 		}
 
-		if Options.ExcludePattern != nil {
-			if Options.ExcludePattern.MatchString(test.name) {
-				if Options.ShowSkipped {
-					Stdout.Println("- [skip]", test.name)
-				}
-				continue
+		if t.Package.options().FailFast && summary.failed > 0 {
+			break
+		}
+	}
+
+	// Run the after-tests. Each test was rolled back, so these see the same state as the tests did.
+	failed := summary.failed
+	for _, after := range t.orderedFixtures(t.AfterTests) {
+		if err = t.runHook(tx, "after-test", after.name, after.stmt); err != nil {
+			pe, ok := err.(*PKGError)
+			if !ok {
+				return err
 			}
+			summary.failures = append(summary.failures, pe)
+			break
 		}
+	}
 
-		if err = t.runTest(tx, test.name, test.stmt); err != nil {
+	failures := summary.failures
+	if t.Package.options().ShowTests || len(failures) > 0 {
+		name := t.Package.Name
+		if t.workers > 1 {
+			name = fmt.Sprintf("%s [worker %d of %d]", name, t.worker+1, t.workers)
+		}
+		Stdout.Printf("%s: %d passed, %d failed, %d skipped\n", name, summary.passed, failed, summary.skipped)
+	}
+
+	if len(failures) > 0 {
+		failures[0].Errors = failures[1:]
+		return failures[0]
+	}
+
+	return nil
+}
+
+// Recreate the state in which a test ran, so that it can be inspected after the test has failed.
+// The test scripts are applied, and the before-functions and the before-file functions of the
+// test's unit are run. With --keep-db-on-failure=commit, the test's setup functions and the test
+// itself are also run, and their effects are kept up to the first error; note that a function
+// which raises an error has no effects to keep.
+func (t *Tests) replay(tx *PkgTx, testName string) error {
+	if err := t.parse(); err != nil {
+		return err
+	}
+
+	testStmt, ok := t.NamedTests[testName]
+	if !ok {
+		return fmt.Errorf("unable to find test %s", testName)
+	}
+
+	if err := applyState(tx, t.state); err != nil {
+		return err
+	}
+
+	for _, before := range t.orderedFixtures(t.BeforeTests) {
+		if err := t.runHook(tx, "before-test", before.name, before.stmt); err != nil {
+			return err
+		}
+	}
+
+	fixtures := t.fixtures[testStmt.Unit]
+	for _, before := range fixtures.beforeFile {
+		if err := t.runHook(tx, "before-file", before.name, before.stmt); err != nil {
 			return err
 		}
 	}
 
+	if !t.Package.options().CommitFailedTest {
+		return nil
+	}
+
+	// The test failed, so errors are expected here. Each function is run in its own savepoint,
+	// so that the effects of the functions which completed are kept.
+	for _, setup := range fixtures.setup {
+		if err := runTestBody(tx, fmt.Sprintf("select %s", setup.name), true); err != nil {
+			return nil
+		}
+	}
+
+	_ = runTestBody(tx, fmt.Sprintf("select %s", testName), true)
 	return nil
 }
 
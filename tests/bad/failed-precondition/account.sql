@@ -0,0 +1,5 @@
+--pgpkg:precondition to_regclass('failed_precondition.ledger') is not null
+create table failed_precondition.account (
+    id integer primary key,
+    ledger_id integer not null
+);
@@ -0,0 +1,6 @@
+--pgpkg:expect-error 23505
+create or replace function unexpected_success.duplicate_test() returns void language plpgsql as $$
+    begin
+        raise notice 'no error';
+    end;
+$$;
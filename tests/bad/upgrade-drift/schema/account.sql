@@ -0,0 +1,3 @@
+create table upgrade_drift.account (
+    id integer primary key
+);
@@ -0,0 +1 @@
+alter table upgrade_drift.account add column name text not null default '';
@@ -0,0 +1,7 @@
+--
+-- Consolidates account.sql and account@001.sql, but forgets that name is not null.
+--
+create table upgrade_drift.account (
+    id integer primary key,
+    name text default ''
+);
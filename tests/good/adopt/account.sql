@@ -0,0 +1,3 @@
+create or replace function adopt.account_name(_id integer) returns text language sql as $$
+    select name from adopt.account where id = _id;
+$$;
@@ -0,0 +1,6 @@
+create or replace function adopt.account_test() returns void language plpgsql as $$
+    begin
+        insert into adopt.account (id, name, active) values (1, 'adopted', true);
+        perform adopt.account_name(1) =? 'adopted';
+    end;
+$$;
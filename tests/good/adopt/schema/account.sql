@@ -0,0 +1,4 @@
+create table adopt.account (
+    id integer primary key,
+    name text not null
+);
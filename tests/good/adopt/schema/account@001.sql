@@ -0,0 +1 @@
+alter table adopt.account add column active boolean not null default true;
@@ -0,0 +1,5 @@
+create or replace function baseline.account_test() returns void language plpgsql as $$
+    begin
+        insert into baseline.account (id, name, active) values (1, 'baseline', true);
+    end;
+$$;
@@ -0,0 +1,3 @@
+create table baseline.account (
+    id integer primary key
+);
@@ -0,0 +1 @@
+alter table baseline.account add column name text not null default '';
@@ -0,0 +1 @@
+alter table baseline.account add column active boolean not null default true;
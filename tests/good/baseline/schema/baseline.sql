@@ -0,0 +1,7 @@
+--
+-- Consolidates account.sql and account@001.sql.
+--
+create table baseline.account (
+    id integer primary key,
+    name text not null default ''
+);
@@ -0,0 +1,12 @@
+--
+-- Conditions can be declared in the comment block at the top of a migration.
+--
+--pgpkg:precondition to_regclass('conditions.account') is null
+--pgpkg:postcondition to_regclass('conditions.account') is not null
+--
+create table conditions.account (
+    id integer primary key,
+    name text
+);
+
+insert into conditions.account (id, name) values (1, 'cash'), (2, 'bank');
@@ -0,0 +1,6 @@
+
+--
+-- Conditions can also be declared in a check file next to the migration.
+--
+--pgpkg:precondition not exists (select 1 from conditions.account where name is null)
+--pgpkg:postcondition (select attnotnull from pg_attribute where attrelid = 'conditions.account'::regclass and attname = 'name')
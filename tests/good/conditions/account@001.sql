@@ -0,0 +1 @@
+alter table conditions.account alter column name set not null;
@@ -0,0 +1,8 @@
+create or replace function data.currency_test() returns void language plpgsql as $$
+    begin
+        perform count(*) =? 3 from data.currency;
+        perform count(*) =? 0 from data.currency where code = 'XXX';
+        perform name =? 'Swiss Franc, with a comma' from data.currency where code = 'CHF';
+        perform count(*) =? 1 from data.currency where symbol is null;
+    end;
+$$;
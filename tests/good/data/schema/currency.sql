@@ -0,0 +1,8 @@
+create table data.currency (
+    code text primary key,
+    name text not null,
+    symbol text
+);
+
+-- This row isn't in the CSV file, so it should be deleted.
+insert into data.currency (code, name) values ('XXX', 'No currency');
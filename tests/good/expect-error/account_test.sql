@@ -0,0 +1,23 @@
+create or replace function expect_error.missing_fails_test() returns void language plpgsql as $$
+    begin
+        perform 1 / 0;
+    end;
+$$;
+
+--
+-- Adding the same account twice violates the primary key.
+--
+--pgpkg:expect-error 23505 duplicate key
+create or replace function expect_error.duplicate_account_test() returns void language plpgsql as $$
+    begin
+        insert into expect_error.account (name) values ('cash');
+        insert into expect_error.account (name) values ('cash');
+    end;
+$$;
+
+--pgpkg:expect-error ^not allowed$
+create or replace function expect_error.message_test() returns void language plpgsql as $$
+    begin
+        raise exception 'not allowed';
+    end;
+$$;
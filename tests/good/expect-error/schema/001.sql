@@ -0,0 +1,3 @@
+create table expect_error.account (
+    name text primary key
+);
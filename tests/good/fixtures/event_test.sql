@@ -0,0 +1,52 @@
+create or replace function fixtures.event_before_file() returns void language plpgsql as $$
+    begin
+        insert into fixtures.event (name) values ('file');
+    end;
+$$;
+
+-- Functions which take arguments aren't fixtures, even if their names end in _setup.
+create or replace function fixtures.record_setup(_name text) returns void language plpgsql as $$
+    begin
+        insert into fixtures.event (name) values (_name);
+    end;
+$$;
+
+create or replace function fixtures.event_setup() returns void language plpgsql as $$
+    begin
+        perform fixtures.record_setup('setup');
+    end;
+$$;
+
+create or replace function fixtures.event_teardown() returns void language plpgsql as $$
+    begin
+        perform (select count(*) from fixtures.event where name = 'setup') =? 1;
+    end;
+$$;
+
+create or replace function fixtures.first_test() returns void language plpgsql as $$
+    begin
+        perform (select count(*) from fixtures.event) =? 2;
+        insert into fixtures.event (name) values ('first');
+    end;
+$$;
+
+create or replace function fixtures.second_test() returns void language plpgsql as $$
+    begin
+        perform (select count(*) from fixtures.event) =? 2;
+        insert into fixtures.event (name) values ('second');
+    end;
+$$;
+
+-- The teardown function still runs after a test raises an error.
+create or replace function fixtures.error_fails_test() returns void language plpgsql as $$
+    begin
+        insert into fixtures.event (name) values ('error');
+        raise exception 'expected failure';
+    end;
+$$;
+
+create or replace function fixtures.event_after() returns void language plpgsql as $$
+    begin
+        perform (select count(*) from fixtures.event) =? 0;
+    end;
+$$;
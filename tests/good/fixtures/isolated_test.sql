@@ -0,0 +1,6 @@
+-- Fixtures declared in other files don't apply to these tests.
+create or replace function fixtures.isolated_test() returns void language plpgsql as $$
+    begin
+        perform (select count(*) from fixtures.event) =? 0;
+    end;
+$$;
@@ -0,0 +1,3 @@
+create table fixtures.event (
+    name text not null
+);
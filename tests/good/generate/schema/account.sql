@@ -0,0 +1,5 @@
+create table generate.account (
+    id integer primary key,
+    name varchar(40),
+    legacy_code text
+);
@@ -0,0 +1,10 @@
+create table generate.account (
+    id integer primary key,
+    name varchar(80) not null,
+    balance numeric(12,2) not null default 0
+);
+
+create table generate.ledger (
+    id integer primary key,
+    account integer not null references generate.account(id)
+);
@@ -0,0 +1,8 @@
+create table go_migration.account (
+    id integer primary key,
+    name text not null
+);
+
+insert into go_migration.account (id, name) values (1, 'cash'), (2, 'bank');
+
+alter table go_migration.account add column code text;
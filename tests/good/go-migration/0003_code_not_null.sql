@@ -0,0 +1 @@
+alter table go_migration.account alter column code set not null;
@@ -0,0 +1,6 @@
+create or replace function go_migration.account_code_test() returns void language plpgsql as $$
+    begin
+        perform code =? 'CASH' from go_migration.account where id = 1;
+        perform code =? 'BANK' from go_migration.account where id = 2;
+    end;
+$$;
@@ -0,0 +1,5 @@
+create or replace function repeatable.currency_test() returns void language plpgsql as $$
+    begin
+        perform count(*) =? 3 from repeatable.currency;
+    end;
+$$;
@@ -0,0 +1,8 @@
+--
+-- Reference data for currencies. This script is run again whenever it changes.
+--
+insert into repeatable.currency (code, name) values
+    ('AUD', 'Australian Dollar'),
+    ('EUR', 'Euro'),
+    ('USD', 'US Dollar')
+on conflict (code) do update set name = excluded.name;
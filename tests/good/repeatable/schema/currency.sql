@@ -0,0 +1,4 @@
+create table repeatable.currency (
+    code text primary key,
+    name text not null
+);
@@ -0,0 +1,111 @@
+package pgpkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Get the names of the tests in the order they will be run.
+func testOrderNames(t *Tests) []string {
+	var names []string
+	for _, tests := range t.getTestStatements() {
+		for _, test := range tests {
+			names = append(names, test.name)
+		}
+	}
+	return names
+}
+
+func TestTestOrder(t *testing.T) {
+	defer func() { Options.TestOrder, Options.TestSeed = "", 0 }()
+
+	u1, u2 := &Unit{Path: "b_test.sql"}, &Unit{Path: "a_test.sql"}
+	tests := &Tests{
+		Bundle: &Bundle{Package: &Package{}, Units: []*Unit{u1, u2}},
+		NamedTests: map[string]*Statement{
+			"z_test()": {Unit: u1, LineNumber: 1},
+			"y_test()": {Unit: u1, LineNumber: 10},
+			"x_test()": {Unit: u1, LineNumber: 20},
+			"c_test()": {Unit: u2, LineNumber: 5},
+			"a_test()": {Unit: u2, LineNumber: 1},
+		},
+	}
+
+	Options.TestOrder = testOrderDeclared
+	if names := testOrderNames(tests); !reflect.DeepEqual(names, []string{"z_test()", "y_test()", "x_test()", "a_test()", "c_test()"}) {
+		t.Errorf("unexpected declared order: %v", names)
+	}
+
+	Options.TestOrder = testOrderSorted
+	if names := testOrderNames(tests); !reflect.DeepEqual(names, []string{"x_test()", "y_test()", "z_test()", "a_test()", "c_test()"}) {
+		t.Errorf("unexpected sorted order: %v", names)
+	}
+
+	Options.TestOrder = testOrderRandom
+	Options.TestSeed = 42
+	first := testOrderNames(tests)
+	for i := 0; i < 10; i++ {
+		if names := testOrderNames(tests); !reflect.DeepEqual(names, first) {
+			t.Fatalf("random order with the same seed is not repeatable: %v, %v", first, names)
+		}
+	}
+}
+
+func TestWorkerShare(t *testing.T) {
+	groups := [][]*testStatement{
+		{{name: "a"}, {name: "b"}, {name: "c"}},
+		{{name: "d"}},
+		{{name: "e"}, {name: "f"}},
+	}
+
+	var all []string
+	for worker := 0; worker < 3; worker++ {
+		tests := &Tests{worker: worker, workers: 3}
+		for _, share := range tests.workerShare(groups) {
+			if len(share) == 0 {
+				t.Errorf("worker %d has an empty group", worker)
+			}
+			for _, test := range share {
+				all = append(all, test.name)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(all, []string{"a", "d", "b", "e", "c", "f"}) {
+		t.Errorf("unexpected worker shares: %v", all)
+	}
+}
+
+func TestSQLTestName(t *testing.T) {
+	if name := sqlTestName(`"gl"."account_create_test"()`); name != "gl.account_create_test" {
+		t.Errorf("unexpected test name: %s", name)
+	}
+}
+
+func TestFixtureArguments(t *testing.T) {
+	p, err := NewProjectFrom("tests/good/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := p.Root.Tests
+	if err = tests.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	// fixtures.record_setup(text) takes an argument, so it isn't a fixture.
+	var setup []string
+	for _, fixtures := range tests.fixtures {
+		for _, stmt := range fixtures.setup {
+			setup = append(setup, stmt.name)
+		}
+	}
+
+	if !reflect.DeepEqual(setup, []string{`"fixtures"."event_setup"()`}) {
+		t.Errorf("unexpected setup functions: %v", setup)
+	}
+}
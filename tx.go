@@ -1,31 +1,53 @@
 package pgpkg
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 )
 
 type PkgTx struct {
 	*sql.Tx
+	ctx     context.Context // statements are cancelled when the context is done; may be nil
+	options *OptionSet      // the options of the project using the transaction; may be nil
+}
+
+// Context returns the context of the transaction. When the context is done, the statement being
+// executed is cancelled, and the transaction is rolled back.
+func (t *PkgTx) Context() context.Context {
+	if t.ctx != nil {
+		return t.ctx
+	}
+
+	return context.Background()
 }
 
 func (t *PkgTx) Exec(query string, args ...any) (sql.Result, error) {
 	t.logQuery(query, args)
-	return t.Tx.Exec(query, args...)
+	return t.Tx.ExecContext(t.Context(), query, args...)
 }
 
 func (t *PkgTx) Query(query string, args ...any) (*sql.Rows, error) {
 	t.logQuery(query, args)
-	return t.Tx.Query(query, args...)
+	return t.Tx.QueryContext(t.Context(), query, args...)
 }
 
 func (t *PkgTx) QueryRow(query string, args ...any) *sql.Row {
 	t.logQuery(query, args)
-	return t.Tx.QueryRow(query, args...)
+	return t.Tx.QueryRowContext(t.Context(), query, args...)
+}
+
+// Get the options used by the transaction.
+func (t *PkgTx) opts() *OptionSet {
+	if t.options != nil {
+		return t.options
+	}
+
+	return &Options
 }
 
 func (t *PkgTx) logQuery(query string, args []any) {
-	if !Options.Verbose {
+	if !t.opts().Verbose {
 		return
 	}
 
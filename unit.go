@@ -6,6 +6,8 @@ package pgpkg
 //
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"strings"
 
@@ -66,28 +68,41 @@ func (u *Unit) addStatement(lineNumber int, sql string, tree *pg_query.RawStmt)
 	u.Statements = append(u.Statements, statement)
 }
 
-// Parse a unit.
-func (u *Unit) Parse() error {
+// Read the contents of the unit's file, unchanged.
+func (u *Unit) readFile() (string, error) {
 	r, err := u.Bundle.Open(u.Path)
 	if err != nil {
-		return PKGErrorf(u, err, "unable to open")
+		return "", PKGErrorf(u, err, "unable to open")
 	}
+	defer r.Close()
 
 	b, err := io.ReadAll(r)
 	if err != nil {
-		return PKGErrorf(u, err, "unable to read")
+		return "", PKGErrorf(u, err, "unable to read")
+	}
+
+	return string(b), nil
+}
+
+// Read the source of a unit, as it will be parsed. Leading and trailing whitespace is removed,
+// and a semicolon is added if there isn't one already. Returns an empty string for empty files, and
+// for files starting with "--pgpkg:ignore".
+func (u *Unit) readSource() (string, error) {
+	contents, err := u.readFile()
+	if err != nil {
+		return "", err
 	}
 
-	source := strings.TrimSpace(string(b))
+	source := strings.TrimSpace(contents)
 
 	// Empty files are OK.
 	if source == "" {
-		return nil
+		return "", nil
 	}
 
 	// Files starting with "--pgpkg:ignore" are ignored
 	if strings.HasPrefix(source, "--pgpkg:ignore") {
-		return nil
+		return "", nil
 	}
 
 	// Automatically add a semicolon to the source if one
@@ -95,6 +110,20 @@ func (u *Unit) Parse() error {
 	if source[len(source)-1] != ';' {
 		source = source + ";"
 	}
+
+	return source, nil
+}
+
+// Parse a unit.
+func (u *Unit) Parse() error {
+	source, err := u.readSource()
+	if err != nil {
+		return err
+	}
+
+	if source == "" {
+		return nil
+	}
 	u.Source = source
 
 	parseResult, err := Parse(source)
@@ -119,6 +148,19 @@ func (u *Unit) Parse() error {
 	return nil
 }
 
+// Hash returns a hash of the unit's source, which can be used to detect changes to the unit.
+// The source is normalised in the same way as when it's parsed, so that the hash doesn't
+// change when the unit is exported or cached.
+func (u *Unit) Hash() (string, error) {
+	source, err := u.readSource()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(h[:]), nil
+}
+
 func (u *Unit) Location() string {
 	if u != nil {
 		return u.Bundle.Location() + "/" + u.Path
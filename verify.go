@@ -0,0 +1,348 @@
+package pgpkg
+
+// Verification checks that the managed objects recorded in pgpkg.managed_object still exist,
+// and that they haven't been changed since they were deployed; for example, by someone
+// hot-fixing a function using psql. It also finds functions and views in package schemas
+// which aren't managed by pgpkg.
+//
+// Definitions are read from the catalog (using pg_get_functiondef, pg_get_viewdef and so on),
+// with the search path set to pg_catalog so that they are always qualified in the same way.
+// Functions are looked up before the search path is changed, since their argument types may not be
+// qualified.
+// The hash of each definition is recorded when the object is deployed, and compared with the
+// live definition when the database is verified.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// Queries that return the OID and definition hash of a managed object, given the name used to look it up.
+// Comments aren't verified.
+var definitionQueries = map[string]string{
+	"function": `select p.oid::bigint, md5(pg_get_functiondef(p.oid))
+	               from pg_proc p where p.oid = $1::oid`,
+
+	"view": `select c.oid::bigint, md5(pg_get_viewdef(c.oid))
+	           from pg_class c where c.oid = to_regclass($1) and c.relkind = 'v'`,
+
+	"trigger": `select t.oid::bigint, md5(pg_get_triggerdef(t.oid))
+	              from pg_trigger t
+	              join pg_class c on c.oid = t.tgrelid
+	              join pg_namespace n on n.oid = c.relnamespace
+	             where format('"%s" on "%s"."%s"', replace(t.tgname, '"', '""'),
+	                          replace(n.nspname, '"', '""'), replace(c.relname, '"', '""')) = $1`,
+
+	"cast": `select c.oid::bigint, md5(c.castfunc::regprocedure::text || ' ' || c.castcontext || ' ' || c.castmethod)
+	           from pg_cast c
+	          where c.castsource = to_regtype(split_part($1, ' as ', 1))
+	            and c.casttarget = to_regtype(split_part($1, ' as ', 2))`,
+}
+
+// Return the name used to look up a managed object in the catalog. Functions are looked up by OID,
+// using the argument types parsed from the function's name. The types are resolved using the current
+// search path, so that unqualified types are found in the same way as when the function was deployed.
+// Returns ok=false if the function doesn't exist.
+func definitionLookupName(tx *PkgTx, objType string, objName string) (lookupName string, ok bool, err error) {
+	if objType != "function" {
+		return objName, true, nil
+	}
+
+	signature, err := managedFunctionSignature(objName)
+	if err != nil {
+		return "", false, err
+	}
+
+	var oid sql.NullInt64
+	if err = tx.QueryRow("select to_regprocedure($1)::oid::bigint", signature).Scan(&oid); err != nil {
+		return "", false, fmt.Errorf("unable to find function %s: %w", objName, err)
+	}
+
+	if !oid.Valid {
+		return "", false, nil
+	}
+
+	return strconv.FormatInt(oid.Int64, 10), true, nil
+}
+
+// Find the OID and definition hash of a managed object, given the name returned by definitionLookupName.
+// Returns ok=false if the object doesn't exist, or if its type can't be verified.
+func readDefinition(tx *PkgTx, objType string, lookupName string) (oid int64, hash string, ok bool, err error) {
+	query, found := definitionQueries[objType]
+	if !found {
+		return 0, "", false, nil
+	}
+
+	rows, err := tx.Query(query, lookupName)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("unable to read definition of %s %s: %w", objType, lookupName, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, "", false, rows.Err()
+	}
+
+	if err = rows.Scan(&oid, &hash); err != nil {
+		return 0, "", false, fmt.Errorf("unable to read definition of %s %s: %w", objType, lookupName, err)
+	}
+
+	return oid, hash, true, nil
+}
+
+// A managed object whose definition has been read from the catalog.
+type objectDefinition struct {
+	oid  int64
+	hash string
+}
+
+// Read the definitions of the given managed objects, indexed in the same way as objTypes and objNames.
+// Objects which don't exist, or whose types can't be verified, are not included. Definitions depend
+// on the search path, so it's changed in a savepoint which is always rolled back; objects are looked
+// up before that.
+func readDefinitions(tx *PkgTx, objTypes []string, objNames []string) (map[int]objectDefinition, error) {
+	lookupNames := make(map[int]string)
+	for i, objType := range objTypes {
+		if _, verifiable := definitionQueries[objType]; !verifiable {
+			continue
+		}
+
+		lookupName, ok, err := definitionLookupName(tx, objType, objNames[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			lookupNames[i] = lookupName
+		}
+	}
+
+	definitions := make(map[int]objectDefinition)
+	err := withCatalogSearchPath(tx, func() error {
+		for i, lookupName := range lookupNames {
+			oid, hash, ok, err := readDefinition(tx, objTypes[i], lookupName)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				definitions[i] = objectDefinition{oid, hash}
+			}
+		}
+
+		return nil
+	})
+
+	return definitions, err
+}
+
+// Read the definition hashes of the given managed objects.
+func readDefinitionHashes(tx *PkgTx, objects []*ManagedObject) (map[*ManagedObject]string, error) {
+	objTypes := make([]string, len(objects))
+	objNames := make([]string, len(objects))
+	for i, obj := range objects {
+		if obj != nil {
+			objTypes[i], objNames[i] = obj.ObjectType, obj.ObjectName
+		}
+	}
+
+	definitions, err := readDefinitions(tx, objTypes, objNames)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[*ManagedObject]string)
+	for i, definition := range definitions {
+		hashes[objects[i]] = definition.hash
+	}
+
+	return hashes, nil
+}
+
+// Run f with the search path set to pg_catalog, so that names in definitions are always qualified.
+// The search path is changed in a savepoint which is always rolled back.
+func withCatalogSearchPath(tx *PkgTx, f func() error) error {
+	if _, err := tx.Exec("savepoint definitions"); err != nil {
+		return fmt.Errorf("unable to create savepoint: %w", err)
+	}
+
+	err := func() error {
+		if _, err := tx.Exec("set local search_path to pg_catalog"); err != nil {
+			return fmt.Errorf("unable to set search path: %w", err)
+		}
+
+		return f()
+	}()
+
+	if _, rbErr := tx.Exec("rollback to savepoint definitions"); rbErr != nil && err == nil {
+		err = fmt.Errorf("unable to rollback savepoint: %w", rbErr)
+	}
+
+	return err
+}
+
+// Drift describes a difference between the managed state of a package and the database.
+type Drift struct {
+	Package    string `json:"package"`
+	ObjectType string `json:"type"`
+	ObjectName string `json:"name"`
+	Problem    string `json:"problem"` // one of "missing", "changed" or "unmanaged"
+}
+
+// Find functions and views which aren't managed by pgpkg.
+var unmanagedQueries = []string{
+	`select 'function', p.oid::bigint, p.oid::regprocedure::text
+	   from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+	  where n.nspname = any($1) and p.prokind in ('f', 'p')
+	    and not exists (select 1 from pg_depend d
+	                     where d.classid = 'pg_proc'::regclass and d.objid = p.oid and d.deptype = 'e')`,
+
+	`select 'view', c.oid::bigint, c.oid::regclass::text
+	   from pg_class c join pg_namespace n on n.oid = c.relnamespace
+	  where n.nspname = any($1) and c.relkind = 'v'
+	    and not exists (select 1 from pg_depend d
+	                     where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype = 'e')`,
+}
+
+// Verify the managed objects of a single package.
+func (p *Package) verify(tx *PkgTx) ([]Drift, error) {
+	state, err := p.MOB.loadState(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	objTypes := make([]string, len(state))
+	objNames := make([]string, len(state))
+	for i, obj := range state {
+		objTypes[i], objNames[i] = obj.objType, obj.objName
+	}
+
+	definitions, err := readDefinitions(tx, objTypes, objNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	managed := make(map[int64]bool)
+
+	for i, obj := range state {
+		if _, verifiable := definitionQueries[obj.objType]; !verifiable {
+			continue
+		}
+
+		definition, ok := definitions[i]
+		switch {
+		case !ok:
+			drift = append(drift, Drift{p.Name, obj.objType, obj.objName, "missing"})
+		case obj.defHash != "" && obj.defHash != definition.hash:
+			drift = append(drift, Drift{p.Name, obj.objType, obj.objName, "changed"})
+		}
+
+		managed[definition.oid] = true
+	}
+
+	err = withCatalogSearchPath(tx, func() error {
+		for _, query := range unmanagedQueries {
+			rows, err := tx.Query(query, pq.Array(p.SchemaNames))
+			if err != nil {
+				return fmt.Errorf("unable to find unmanaged objects: %w", err)
+			}
+
+			for rows.Next() {
+				var objType, objName string
+				var oid int64
+				if err = rows.Scan(&objType, &oid, &objName); err != nil {
+					_ = rows.Close()
+					return fmt.Errorf("unable to find unmanaged objects: %w", err)
+				}
+
+				if !managed[oid] {
+					drift = append(drift, Drift{p.Name, objType, objName, "unmanaged"})
+				}
+			}
+
+			if err = rows.Err(); err != nil {
+				return fmt.Errorf("unable to find unmanaged objects: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return drift, nil
+}
+
+// Verify compares the managed objects of each package in the project with the live database,
+// and returns a list of objects which are missing, have been changed since they were deployed,
+// or which exist in a package schema without being managed by pgpkg. The database is not changed.
+//
+// The pgpkg package itself is not verified, since its functions are created by migrations.
+func (p *Project) Verify(dsn string) ([]Drift, error) {
+	if err := p.Parse(); err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(dsn, p.options())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	// Nothing is changed.
+	defer dbtx.Rollback()
+	tx := &PkgTx{Tx: dbtx, options: p.options()}
+
+	var installed bool
+	if err = tx.QueryRow("select to_regclass('pgpkg.managed_object') is not null").Scan(&installed); err != nil {
+		return nil, fmt.Errorf("unable to read pgpkg schema: %w", err)
+	}
+
+	if !installed {
+		return nil, fmt.Errorf("pgpkg is not installed in this database")
+	}
+
+	pkgNames, err := p.sortPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []Drift
+	for _, pkgName := range pkgNames {
+		if pkgName == "github.com/pgpkg/pgpkg" {
+			continue
+		}
+
+		pkgDrift, err := p.pkgs[pkgName].verify(tx)
+		if err != nil {
+			return nil, err
+		}
+		drift = append(drift, pkgDrift...)
+	}
+
+	return drift, nil
+}
+
+// WriteDriftJSON writes a list of drift as JSON.
+func WriteDriftJSON(w io.Writer, drift []Drift) error {
+	if drift == nil {
+		drift = []Drift{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(drift)
+}
@@ -0,0 +1,29 @@
+package pgpkg
+
+import "testing"
+
+func TestManagedFunctionSignature(t *testing.T) {
+	tests := []struct {
+		objName string
+		want    string
+	}{
+		{`"s"."f"()`, `"s"."f"()`},
+		{`"s"."f"(a "pg_catalog"."int4",b "pg_catalog"."text"[])`, `"s"."f"("pg_catalog"."int4","pg_catalog"."text"[])`},
+		{`"s"."f"( "pg_catalog"."int4")`, `"s"."f"("pg_catalog"."int4")`},
+		{`"s"."f"(a "pg_catalog"."numeric",b "my_enum")`, `"s"."f"("pg_catalog"."numeric","my_enum")`},
+		{`"s"."f"(a "my,type")`, `"s"."f"("my,type")`},
+	}
+
+	for _, test := range tests {
+		got, err := managedFunctionSignature(test.objName)
+		if err != nil {
+			t.Errorf("managedFunctionSignature(%s): %v", test.objName, err)
+		} else if got != test.want {
+			t.Errorf("managedFunctionSignature(%s) = %s, want %s", test.objName, got, test.want)
+		}
+	}
+
+	if _, err := managedFunctionSignature(`"f"()`); err == nil {
+		t.Errorf("expected an error for an unqualified function name")
+	}
+}
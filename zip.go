@@ -3,6 +3,7 @@ package pgpkg
 import (
 	"archive/zip"
 	"fmt"
+	"io"
 	"path"
 )
 
@@ -12,11 +13,17 @@ import (
 //
 
 // Write the contents of the migration file.
-func writeMigration(zw *zip.Writer, pkgPath string, schema *Schema) error {
+func writeMigration(zw *zip.Writer, pkgPath string, pkg *Package) error {
+	schema := pkg.Schema
 	if len(schema.migrationIndex) == 0 {
 		return nil // no migration scripts; nothing to import.
 	}
 
+	// migrations are managed in the config file, nothing to see here
+	if len(pkg.config.Migrations) > 0 {
+		return nil
+	}
+
 	filename := path.Join(pkgPath, schema.migrationDir, "/@migration.pgpkg")
 	mw, err := zw.Create(filename)
 	if err != nil {
@@ -63,6 +70,32 @@ func zipWriteUnits(zw *zip.Writer, pkgPath string, bundle *Bundle) error {
 	return nil
 }
 
+// Data files aren't SQL, so they are copied as-is.
+func zipWriteFiles(zw *zip.Writer, pkgPath string, bundle *Bundle) error {
+	for _, unit := range bundle.Units {
+		unitpath := path.Join(pkgPath, unit.Path)
+
+		r, err := bundle.Open(unit.Path)
+		if err != nil {
+			return fmt.Errorf("unable to open %s: %w", unitpath, err)
+		}
+
+		uw, err := zw.Create(unitpath)
+		if err != nil {
+			_ = r.Close()
+			return fmt.Errorf("unable to create file %s: %w", unitpath, err)
+		}
+
+		_, err = io.Copy(uw, r)
+		_ = r.Close()
+		if err != nil {
+			return fmt.Errorf("unable to write file %s: %w", unitpath, err)
+		}
+	}
+
+	return nil
+}
+
 func writePackage(zw *zip.Writer, pkg *Package) error {
 
 	var pkgPath string
@@ -76,7 +109,7 @@ func writePackage(zw *zip.Writer, pkg *Package) error {
 		return err
 	}
 
-	if err := writeMigration(zw, pkgPath, pkg.Schema); err != nil {
+	if err := writeMigration(zw, pkgPath, pkg); err != nil {
 		return err // FIXME: add context
 	}
 
@@ -92,6 +125,10 @@ func writePackage(zw *zip.Writer, pkg *Package) error {
 		return err
 	}
 
+	if err := zipWriteFiles(zw, pkgPath, pkg.Data.Bundle); err != nil {
+		return err
+	}
+
 	return nil
 }
 
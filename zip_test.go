@@ -61,3 +61,66 @@ func TestZip(t *testing.T) {
 
 	showZip(buf.Bytes())
 }
+
+func TestExportMigrations(t *testing.T) {
+	for _, pkgPath := range []string{"tests/good/baseline", "tests/good/data", "tests/good/repeatable"} {
+		p, err := NewProjectFrom(pkgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		zipWriter := zip.NewWriter(buf)
+		if err = WriteProject(zipWriter, p); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = zipWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Reload the exported package, which lists its migrations in pgpkg.toml.
+		src, err := NewZipByteSource(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exported := NewProject()
+		exportedPkg, err := exported.AddSource(src)
+		if err != nil {
+			t.Fatalf("%s: %v", pkgPath, err)
+		}
+
+		if err = exported.Parse(); err != nil {
+			t.Fatalf("%s: %v", pkgPath, err)
+		}
+
+		// Exporting a package doesn't change the hashes of its migrations, so repeatable
+		// migrations aren't run again.
+		exportedUnits := make(map[string]*Unit)
+		for _, unit := range exportedPkg.Schema.Bundle.Units {
+			exportedUnits[unit.Path] = unit
+		}
+
+		for _, unit := range p.Root.Schema.Bundle.Units {
+			exportedUnit, ok := exportedUnits[unit.Path]
+			if !ok {
+				t.Fatalf("%s: %s was not exported", pkgPath, unit.Path)
+			}
+
+			hash, err := unit.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exportedHash, err := exportedUnit.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hash != exportedHash {
+				t.Errorf("%s: hash of %s changed when exported", pkgPath, unit.Path)
+			}
+		}
+	}
+}